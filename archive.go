@@ -0,0 +1,356 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// archiveDir is the directory in the data directory that reaped messages are archived
+// in, with a directory for each guild and channel under it.
+const archiveDir = "archive"
+
+// ArchivedMessage is a message as it's kept in the archive, once it's been reaped.
+type ArchivedMessage struct {
+	ID              discord.MessageID    `json:"id"`
+	GuildID         discord.GuildID      `json:"guildID"`
+	ChannelID       discord.ChannelID    `json:"channelID"`
+	AuthorID        discord.UserID       `json:"authorID"`
+	AuthorTag       string               `json:"authorTag"`
+	AuthorBot       bool                 `json:"authorBot,omitempty"`
+	Content         string               `json:"content"`
+	Timestamp       time.Time            `json:"timestamp"`
+	EditedTimestamp *time.Time           `json:"editedTimestamp,omitempty"`
+	ReplyTo         discord.MessageID    `json:"replyTo,omitempty"`
+	Attachments     []ArchivedAttachment `json:"attachments,omitempty"`
+	Embeds          []discord.Embed      `json:"embeds,omitempty"`
+}
+
+// ArchivedAttachment records the details of a file attached to an archived message.
+// The file itself isn't kept, as its URL stops working once the message is deleted.
+type ArchivedAttachment struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        uint64 `json:"size"`
+	URL         string `json:"url"`
+}
+
+// newArchivedMessage turns a message into the form it's archived in.
+func newArchivedMessage(guildID discord.GuildID, message discord.Message) ArchivedMessage {
+	archived := ArchivedMessage{
+		ID:        message.ID,
+		GuildID:   guildID,
+		ChannelID: message.ChannelID,
+		AuthorID:  message.Author.ID,
+		AuthorTag: message.Author.Tag(),
+		AuthorBot: message.Author.Bot,
+		Content:   message.Content,
+		Timestamp: message.Timestamp.Time().UTC(),
+		Embeds:    message.Embeds,
+	}
+
+	if message.EditedTimestamp.IsValid() {
+		edited := message.EditedTimestamp.Time().UTC()
+		archived.EditedTimestamp = &edited
+	}
+	if message.Reference != nil {
+		archived.ReplyTo = message.Reference.MessageID
+	}
+	for _, attachment := range message.Attachments {
+		archived.Attachments = append(archived.Attachments, ArchivedAttachment{
+			Filename:    attachment.Filename,
+			ContentType: attachment.ContentType,
+			Size:        attachment.Size,
+			URL:         string(attachment.URL),
+		})
+	}
+
+	return archived
+}
+
+// archiveTranscriptHeader starts the HTML transcript of an archive.
+var archiveTranscriptHeader = template.Must(template.New("header").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Reaped messages from #{{.Name}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; }
+.message { border-bottom: 1px solid #ddd; padding: 0.5em 0; }
+.meta { color: #666; font-size: 0.9em; }
+.content { white-space: pre-wrap; }
+.embed { border-left: 4px solid #ccc; padding-left: 0.5em; margin-top: 0.25em; }
+</style>
+</head>
+<body>
+<h1>Reaped messages from #{{.Name}}</h1>
+<p>Channel {{.ChannelID}}{{if .ParentID.IsValid}}, a thread in channel {{.ParentID}}{{end}} in guild {{.GuildID}}, reaped {{.StartedAt.Format "2 January 2006 15:04:05 MST"}}. Newest messages come first.</p>
+`))
+
+// archiveTranscriptMessage is a message in the HTML transcript of an archive.
+var archiveTranscriptMessage = template.Must(template.New("message").Parse(`<div class="message" id="{{.ID}}">
+<div class="meta"><strong>{{.AuthorTag}}</strong>{{if .AuthorBot}} (bot){{end}} ({{.AuthorID}}) at {{.Timestamp.Format "2006-01-02 15:04:05 MST"}}{{if .EditedTimestamp}}, edited {{.EditedTimestamp.Format "2006-01-02 15:04:05 MST"}}{{end}}{{if .ReplyTo.IsValid}}, replying to <a href="#{{.ReplyTo}}">{{.ReplyTo}}</a>{{end}}</div>
+<div class="content">{{.Content}}</div>
+{{range .Attachments}}<div class="attachment">📎 {{.Filename}} ({{.Size}} bytes{{if .ContentType}}, {{.ContentType}}{{end}})</div>
+{{end}}{{range .Embeds}}<div class="embed">{{if .Title}}<strong>{{.Title}}</strong><br>{{end}}{{.Description}}</div>
+{{end}}</div>
+`))
+
+// reapArchive is where the messages reaped from a channel in one run are archived - a
+// JSONL file with a message on each line, and an HTML transcript to read them in.
+type reapArchive struct {
+	jsonl *os.File
+	html  *os.File
+}
+
+// openReapArchive creates the archive files for reaping a channel, named after when the
+// reaping started.
+func openReapArchive(guildID discord.GuildID, channel discord.Channel, startedAt time.Time) (*reapArchive, error) {
+	parentID := discord.ChannelID(0)
+	if isThread(channel) {
+		parentID = channel.ParentID
+	}
+
+	// threads are archived alongside the channel they're in, so they're pruned with it
+	dir := channelArchiveDir(guildID, archiveChannelID(channel))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	name := filepath.Join(dir, startedAt.UTC().Format("2006-01-02T150405Z"))
+	if parentID.IsValid() {
+		name += threadArchiveSuffix(channel.ID)
+	}
+	jsonl, err := os.OpenFile(name+".jsonl", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	html, err := os.OpenFile(name+".html", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		jsonl.Close()
+		return nil, err
+	}
+
+	err = archiveTranscriptHeader.Execute(html, struct {
+		GuildID   discord.GuildID
+		ChannelID discord.ChannelID
+		ParentID  discord.ChannelID
+		Name      string
+		StartedAt time.Time
+	}{guildID, channel.ID, parentID, channel.Name, startedAt})
+	if err != nil {
+		jsonl.Close()
+		html.Close()
+		return nil, err
+	}
+
+	return &reapArchive{jsonl: jsonl, html: html}, nil
+}
+
+// Write archives messages, making sure they've reached the disk before returning, as
+// they're about to be deleted.
+func (a *reapArchive) Write(guildID discord.GuildID, messages []discord.Message) error {
+	encoder := json.NewEncoder(a.jsonl)
+	for _, message := range messages {
+		archived := newArchivedMessage(guildID, message)
+		if err := encoder.Encode(archived); err != nil {
+			return err
+		}
+		if err := archiveTranscriptMessage.Execute(a.html, archived); err != nil {
+			return err
+		}
+	}
+
+	if err := a.jsonl.Sync(); err != nil {
+		return err
+	}
+	return a.html.Sync()
+}
+
+// Close finishes the archive's transcript, and closes its files.
+func (a *reapArchive) Close() error {
+	_, htmlErr := a.html.WriteString("</body>\n</html>\n")
+	if err := a.html.Close(); htmlErr == nil {
+		htmlErr = err
+	}
+	if err := a.jsonl.Close(); err != nil {
+		return err
+	}
+	return htmlErr
+}
+
+// channelArchiveDir returns the directory a channel's reaped messages are archived in.
+func channelArchiveDir(guildID discord.GuildID, channelID discord.ChannelID) string {
+	return dataPath(filepath.Join(archiveDir, guildID.String(), channelID.String()))
+}
+
+// archiveChannelID returns the channel whose directory a channel's reaped messages are
+// archived in - its own, or the one it's in if it's a thread.
+func archiveChannelID(channel discord.Channel) discord.ChannelID {
+	if isThread(channel) {
+		return channel.ParentID
+	}
+	return channel.ID
+}
+
+// threadArchiveSuffix is added to the names of a thread's archive files, as they're kept
+// alongside those of the channel it's in.
+func threadArchiveSuffix(threadID discord.ChannelID) string {
+	return "-thread-" + threadID.String()
+}
+
+// archiveFileThreadID returns the thread an archive file is for, if it's for one.
+func archiveFileThreadID(name string) (discord.ChannelID, bool) {
+	i := strings.LastIndex(name, "-thread-")
+	if i < 0 {
+		return 0, false
+	}
+	id, err := discord.ParseSnowflake(strings.TrimSuffix(strings.TrimSuffix(name[i+len("-thread-"):], ".jsonl"), ".html"))
+	if err != nil {
+		return 0, false
+	}
+	return discord.ChannelID(id), true
+}
+
+// pruneChannelArchive deletes a channel's archive files that are older than retention,
+// returning how many were deleted. A thread's are only its own, from the directory of
+// the channel it's in.
+func pruneChannelArchive(guildID discord.GuildID, channel discord.Channel, retention time.Duration) (int, error) {
+	pruned, err := pruneArchiveDir(channelArchiveDir(guildID, archiveChannelID(channel)), retention, func(name string) bool {
+		if !isThread(channel) {
+			return true
+		}
+		threadID, ok := archiveFileThreadID(name)
+		return ok && threadID == channel.ID
+	})
+	if pruned > 0 {
+		log.Println("Deleted", pruned, "archive files older than", formatDuration(retention), "for channel", channel.ID)
+	}
+	return pruned, err
+}
+
+// pruneArchiveDir deletes the archive files in a directory that are older than retention
+// and that prune says to, returning how many were deleted.
+func pruneArchiveDir(dir string, retention time.Duration, prune func(name string) bool) (int, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	cutoff := time.Now().Add(-retention)
+	pruned := 0
+	for _, file := range files {
+		if file.IsDir() || !(strings.HasSuffix(file.Name(), ".jsonl") || strings.HasSuffix(file.Name(), ".html")) {
+			continue
+		}
+		if file.ModTime().After(cutoff) || !prune(file.Name()) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			return pruned, fmt.Errorf("failed deleting archive file %s: %w", file.Name(), err)
+		}
+		pruned++
+	}
+	return pruned, nil
+}
+
+// longestArchiveRetention returns the longest archiveRetention set for any channel,
+// category or guild default in the config, or zero if none have one.
+func longestArchiveRetention(c Config) time.Duration {
+	longest := time.Duration(0)
+	consider := func(channelConfig ChannelConfig) {
+		if retention := time.Duration(channelConfig.ArchiveRetention); retention > longest {
+			longest = retention
+		}
+	}
+	for _, guildConfig := range c.Guilds {
+		for _, channelConfig := range guildConfig.Channels {
+			consider(channelConfig)
+		}
+		for _, channelConfig := range guildConfig.Categories {
+			consider(channelConfig)
+		}
+		if guildConfig.Reaper != nil {
+			consider(*guildConfig.Reaper)
+		}
+	}
+	return longest
+}
+
+// sweepArchives prunes the archives of channels that aren't reaped any more, which
+// would otherwise never be pruned.
+func (b *Bot) sweepArchives(c Config) {
+	// nothing's deleted sooner than a channel still reaped would delete it, or at all if no channel sets a retention
+	retention := longestArchiveRetention(c)
+	if retention <= 0 {
+		return
+	}
+
+	guildDirs, err := ioutil.ReadDir(dataPath(archiveDir))
+	if os.IsNotExist(err) {
+		return
+	} else if err != nil {
+		log.Println("Failed listing the archive with error", err)
+		return
+	}
+
+	for _, guildDir := range guildDirs {
+		guildSnowflake, err := discord.ParseSnowflake(guildDir.Name())
+		if !guildDir.IsDir() || err != nil {
+			continue
+		}
+		guildID := discord.GuildID(guildSnowflake)
+		guildConfig, configured := c.Guilds[guildID]
+
+		channelDirs, err := ioutil.ReadDir(dataPath(filepath.Join(archiveDir, guildDir.Name())))
+		if err != nil {
+			log.Println("Failed listing the archive for guild", guildID, "with error", err)
+			continue
+		}
+		for _, channelDir := range channelDirs {
+			channelSnowflake, err := discord.ParseSnowflake(channelDir.Name())
+			if !channelDir.IsDir() || err != nil {
+				continue
+			}
+			channelID := discord.ChannelID(channelSnowflake)
+
+			// channels that are still reaped have their archives pruned as they're reaped
+			if configured {
+				channel, err := b.State.Channel(channelID)
+				if err != nil && !isNotFound(err) {
+					log.Println("Failed checking whether channel", channelID, "is still reaped, so not sweeping its archive:", err)
+					continue
+				}
+				if err == nil {
+					if _, reaped := guildConfig.reapPolicy(*channel); reaped {
+						continue
+					}
+				}
+			}
+
+			pruned, err := pruneArchiveDir(channelArchiveDir(guildID, channelID), retention, func(name string) bool {
+				// threads configured by themselves are archived here even when their channel isn't reaped
+				threadID, ok := archiveFileThreadID(name)
+				_, threadReaped := guildConfig.Channels[threadID]
+				return !(configured && ok && threadReaped)
+			})
+			if err != nil {
+				log.Println("Failed sweeping the archive for channel", channelID, "with error", err)
+			}
+			if pruned > 0 {
+				log.Println("Deleted", pruned, "archive files older than", formatDuration(retention), "for channel", channelID, "in guild", guildID, "which isn't reaped any more")
+			}
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// withDataDir sets $DATA_DIR to a new temporary directory for the length of a test.
+func withDataDir(t *testing.T) {
+	dir := t.TempDir()
+	previous, wasSet := os.LookupEnv("DATA_DIR")
+	os.Setenv("DATA_DIR", dir)
+	t.Cleanup(func() {
+		if wasSet {
+			os.Setenv("DATA_DIR", previous)
+		} else {
+			os.Unsetenv("DATA_DIR")
+		}
+	})
+}
+
+// writeArchiveFile creates an archive file, last changed age ago.
+func writeArchiveFile(t *testing.T, dir string, name string, age time.Duration) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	changed := time.Now().Add(-age)
+	if err := os.Chtimes(path, changed, changed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// archiveFileNames lists the files in an archive directory, in order.
+func archiveFileNames(t *testing.T, dir string) []string {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestArchiveFileThreadID(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   discord.ChannelID
+		wantOK bool
+	}{
+		{"2024-01-10T120000Z.jsonl", 0, false},
+		{"2024-01-10T120000Z-thread-123.jsonl", 123, true},
+		{"2024-01-10T120000Z-thread-123.html", 123, true},
+		{"2024-01-10T120000Z-thread-abc.html", 0, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, ok := archiveFileThreadID(test.name)
+			if got != test.want || ok != test.wantOK {
+				t.Errorf("archiveFileThreadID(%q) = %v, %v, want %v, %v", test.name, got, ok, test.want, test.wantOK)
+			}
+		})
+	}
+}
+
+func TestPruneChannelArchive(t *testing.T) {
+	withDataDir(t)
+	dir := channelArchiveDir(1, 10)
+	old, recent := 10*24*time.Hour, time.Hour
+	writeArchiveFile(t, dir, "old.jsonl", old)
+	writeArchiveFile(t, dir, "old.html", old)
+	writeArchiveFile(t, dir, "recent.jsonl", recent)
+	writeArchiveFile(t, dir, "old-thread-20.jsonl", old)
+	writeArchiveFile(t, dir, "old-thread-30.jsonl", old)
+	writeArchiveFile(t, dir, "notes.txt", old)
+
+	thread := discord.Channel{ID: 20, ParentID: 10, Type: discord.GuildPublicThread}
+	if pruned, err := pruneChannelArchive(1, thread, 7*24*time.Hour); err != nil || pruned != 1 {
+		t.Fatalf("pruneChannelArchive for a thread = %d, %v, want 1, nil", pruned, err)
+	}
+	want := []string{"notes.txt", "old-thread-30.jsonl", "old.html", "old.jsonl", "recent.jsonl"}
+	if names := archiveFileNames(t, dir); !reflect.DeepEqual(names, want) {
+		t.Errorf("after pruning the thread, the archive has %v, want %v", names, want)
+	}
+
+	channel := discord.Channel{ID: 10, Type: discord.GuildText}
+	if pruned, err := pruneChannelArchive(1, channel, 7*24*time.Hour); err != nil || pruned != 3 {
+		t.Fatalf("pruneChannelArchive for a channel = %d, %v, want 3, nil", pruned, err)
+	}
+	want = []string{"notes.txt", "recent.jsonl"}
+	if names := archiveFileNames(t, dir); !reflect.DeepEqual(names, want) {
+		t.Errorf("after pruning the channel, the archive has %v, want %v", names, want)
+	}
+}
+
+func TestLongestArchiveRetention(t *testing.T) {
+	c := Config{Guilds: GuildConfigs{
+		1: {
+			Channels:   ChannelConfigs{10: {ArchiveRetention: Duration(24 * time.Hour)}},
+			Categories: CategoryConfigs{20: {ArchiveRetention: Duration(72 * time.Hour)}},
+		},
+		2: {Reaper: &ChannelConfig{ArchiveRetention: Duration(48 * time.Hour)}},
+	}}
+	if got := longestArchiveRetention(c); got != 72*time.Hour {
+		t.Errorf("longestArchiveRetention = %v, want %v", got, 72*time.Hour)
+	}
+	if got := longestArchiveRetention(Config{}); got != 0 {
+		t.Errorf("longestArchiveRetention with nothing configured = %v, want 0", got)
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -12,73 +16,23 @@ import (
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/diamondburned/arikawa/v3/utils/httputil"
 	"github.com/diamondburned/arikawa/v3/utils/json/option"
 )
 
+// verifiedRoles caches the roles called verified found in guilds that haven't set one up,
+// guarded by verifiedRolesMutex.
 var verifiedRoles map[discord.GuildID]*discord.Role = map[discord.GuildID]*discord.Role{}
-
-// colour_button_prefix defines a prefix for the IDs on the buttons that set a person's colour roles.
-const colour_button_prefix = "colour_button_"
-
-// pronoun_button_prefix defines a prefix for the IDs on the buttons that set a person's pronoun roles.
-const pronoun_button_prefix = "pronoun_button_"
-
-// role_button_prefix defines a prefix for the IDs on the buttons that set a person's generic roles.
-const role_button_prefix = "role_button_"
-
-// verify_button_guild_prefix defines a prefix for the IDs on buttons that allow someone to verify in a specified guild - used for DMs.
-const verify_button_guild_prefix = "verifyme_button_guild_"
+var verifiedRolesMutex sync.Mutex
 
 // Bot holds the current Discord state, and allows access to all of the bot's methods.
 type Bot struct {
 	State *state.State
 }
 
-// CreatePronounPicker is run by the interaction event dispatcher when the command
-// to create a pronoun picker in the current channel is activated.
-func (bot *Bot) CreatePronounPicker(e *gateway.InteractionCreateEvent, guild discord.Guild) error {
-	// the event dispatcher has already checked we're in a guild, etc.
-
-	if err := bot.State.RespondInteraction(e.ID, e.Token,
-		generateInteractionResponseWithButtons(pronoun_button_prefix, config.Pronouns, "👋 What pronouns do you use?")); err != nil {
-		log.Println("failed to send interaction callback in pronoun picker:", err)
-		return err
-	} else {
-		return nil
-	}
-}
-
-// CreateColourPicker is run by the interaction event dispatcher when the command
-// to create a colour picker in the current channel is activated.
-func (bot *Bot) CreateColourPicker(e *gateway.InteractionCreateEvent, guild discord.Guild) error {
-	// the event dispatcher has already checked we're in a guild, etc.
-
-	if err := bot.State.RespondInteraction(e.ID, e.Token,
-		generateInteractionResponseWithButtons(colour_button_prefix, config.Guilds[guild.ID].Colours, "🎨 Pick a colour for your username!")); err != nil {
-		log.Println("failed to send interaction callback in colour picker:", err)
-		return err
-	} else {
-		return nil
-	}
-}
-
-// CreateRolePicker is run by the interaction event dispatcher when the command
-// to create a generic role picker in the current channel is activated.
-func (bot *Bot) CreateRolePicker(e *gateway.InteractionCreateEvent, guild discord.Guild) error {
-	// the event dispatcher has already checked we're in a guild, etc.
-
-	if err := bot.State.RespondInteraction(e.ID, e.Token,
-		generateInteractionResponseWithButtons(role_button_prefix, config.Guilds[guild.ID].Roles, "📋 Collect any extra roles you'd like.")); err != nil {
-		log.Println("failed to send interaction callback in role picker:", err)
-		return err
-	} else {
-		return nil
-	}
-}
-
-// generateInteractionResponseWithButtons generates an InteractionResponse with a series of buttons,
-// in the appropriate number of action rows.
-func generateInteractionResponseWithButtons(prefix string, buttons []string, content string) api.InteractionResponse {
+// generateButtonComponents generates a series of buttons, in the appropriate number of action rows.
+// Each button is labelled with a name from buttons, and given the custom ID at the same index in customIDs.
+func generateButtonComponents(buttons []string, customIDs []discord.ComponentID) discord.ContainerComponents {
 	actionRows := discord.ContainerComponents{}
 
 	// Each row can only hold five components, so we need to do this for
@@ -103,7 +57,7 @@ func generateInteractionResponseWithButtons(prefix string, buttons []string, con
 			thisButtonRuneArray[0] = unicode.ToUpper(thisButtonRuneArray[0])
 
 			actionRowComponents = append(actionRowComponents, &discord.ButtonComponent{
-				CustomID: discord.ComponentID(prefix + thisButton),
+				CustomID: customIDs[j],
 				Label:    string(thisButtonRuneArray),
 				Style:    discord.SecondaryButtonStyle(),
 			})
@@ -112,44 +66,7 @@ func generateInteractionResponseWithButtons(prefix string, buttons []string, con
 		actionRows = append(actionRows, &actionRowComponents)
 	}
 
-	return api.InteractionResponse{
-		Type: api.MessageInteractionWithSource,
-		Data: &api.InteractionResponseData{
-			Content:    option.NewNullableString(content),
-			Components: &actionRows,
-		},
-	}
-}
-
-// CreateVerificationButton is run by the interaction event dispatcher when the command
-// to create a verification button in the current channel is activated.
-func (bot *Bot) CreateVerificationButton(e *gateway.InteractionCreateEvent) error {
-	// the event dispatcher has already checked we're in a guild, etc.
-	data := api.InteractionResponse{
-		Type: api.MessageInteractionWithSource,
-		Data: &api.InteractionResponseData{
-			Content: option.NewNullableString("Ready to get verified? Click here to start the process..."),
-			Components: discord.ComponentsPtr(
-				&discord.ActionRowComponent{
-					&discord.ButtonComponent{
-						CustomID: "verifyme_button",
-						Label:    "Let's get verified!",
-						Emoji: &discord.ComponentEmoji{
-							Name: "🎉",
-						},
-						Style: discord.PrimaryButtonStyle(),
-					},
-				},
-			),
-		},
-	}
-
-	if err := bot.State.RespondInteraction(e.ID, e.Token, data); err != nil {
-		log.Println("failed to send interaction callback:", err)
-		return err
-	} else {
-		return nil
-	}
+	return actionRows
 }
 
 // OnVerifyMeButton is run by the interaction event dispatcher when the "Verify me"
@@ -175,7 +92,7 @@ func (bot *Bot) OnVerifyMeButton(e *gateway.InteractionCreateEvent) error {
 			},
 		}
 
-		if err := bot.State.RespondInteraction(e.ID, e.Token, data); err != nil {
+		if err := bot.responder(e).Respond(data); err != nil {
 			log.Println("failed to send interaction callback for already-registered interaction:", err)
 			return err
 		} else {
@@ -191,7 +108,7 @@ func (bot *Bot) OnVerifyMeButton(e *gateway.InteractionCreateEvent) error {
 			},
 		}
 
-		if err := bot.State.RespondInteraction(e.ID, e.Token, data); err != nil {
+		if err := bot.responder(e).Respond(data); err != nil {
 			log.Println("failed to send interaction callback for failed interaction:", err)
 			return err
 		} else {
@@ -200,81 +117,207 @@ func (bot *Bot) OnVerifyMeButton(e *gateway.InteractionCreateEvent) error {
 	}
 }
 
+// OnVerifyInGuildButton is run by the interaction event dispatcher when a button in a DM
+// asking a member to verify themselves for a guild is pressed.
+func (bot *Bot) OnVerifyInGuildButton(e *gateway.InteractionCreateEvent, id CustomID) error {
+	if e.User == nil {
+		return fmt.Errorf("DM verification button for guild %s pressed outside of DMs", id.GuildID)
+	}
+
+	// Send an interaction as we start the verification process to acknowledge the button
+	if err := bot.respondEphemerally(e, "Verification started! Your verified role has been removed temporarily while you verify yourself - as soon as this is done, it'll be back 😄"); err != nil {
+		return err
+	}
+
+	return bot.VerifyUser(*e.User, id.GuildID)
+}
+
 // InteractionToggleUserRole responds to an InteractionCreateEvent from the dispatcher by
-// assigning a user a role, wrapping toggleUserRole.
-func (bot *Bot) InteractionToggleUserRole(e *gateway.InteractionCreateEvent, member *discord.Member, roleName string, guildID discord.GuildID, auditLogReason string) error {
-	assigned, err := bot.toggleUserRole(member, roleName, guildID, auditLogReason)
+// assigning a user a role, wrapping toggleUserRole. The role is the one given, if it's
+// known, or else the one with the name given. It must still be offered by the guild's
+// config for the kind of picker the button came from, and the member must meet its
+// prerequisites to take it.
+func (bot *Bot) InteractionToggleUserRole(e *gateway.InteractionCreateEvent, member *discord.Member, kind PickerKind, role *discord.Role, roleName string, guildID discord.GuildID, auditLogReason string) error {
+	if member == nil {
+		return fmt.Errorf("role button %s pressed outside of a guild", roleName)
+	}
+
+	roleConfig := offeredPickerRole(kind, guildID, roleName)
+	if roleConfig == nil {
+		return bot.respondEphemerally(e, fmt.Sprintf("Sorry, the %s role isn't available any more 😢", roleName))
+	}
+
+	existingRole := role
+	if existingRole == nil {
+		var err error
+		existingRole, err = bot.findRoleByName(guildID, roleConfig.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Anyone can give up a role they hold, so prerequisites only matter when taking one.
+	if existingRole == nil || !memberHasRole(member, existingRole.ID) {
+		unmet, err := bot.unmetRoleRequirement(member, guildID, *roleConfig)
+		if err != nil {
+			return err
+		}
+
+		if unmet != "" {
+			return bot.respondEphemerally(e, unmet)
+		}
+	}
+
+	assigned, roleID, err := bot.toggleUserRole(member, existingRole, roleConfig.Name, guildID, auditLogReason)
 	if err != nil {
 		return err
 	}
 
 	var message string
 	if assigned {
-		message = "Now you've got the"
+		message = fmt.Sprintf("Nice job! Now you've got the %s role 😊", roleConfig.Name)
+
+		if roleConfig.Duration > 0 {
+			expiresAt := time.Now().Add(time.Duration(roleConfig.Duration))
+			if err := scheduleRoleExpiry(guildID, member.User.ID, roleID, expiresAt); err != nil {
+				return err
+			}
+			message += fmt.Sprintf(" It'll be removed again <t:%d:R>.", expiresAt.Unix())
+		}
+
+		if kind == ColourPicker {
+			if err := bot.removeCustomColourRole(guildID, member.User.ID, "Picked a colour from the picker instead"); err != nil {
+				return err
+			}
+		}
+	} else {
+		message = fmt.Sprintf("Nice job! No more %s role 😊", roleConfig.Name)
+
+		if err := cancelRoleExpiry(guildID, member.User.ID, roleID); err != nil {
+			return err
+		}
+	}
+
+	if err := bot.respondEphemerally(e, message); err != nil {
+		log.Println("failed to send interaction callback for assigning user role interaction:", err)
+		return err
 	} else {
-		message = "No more"
+		return nil
 	}
+}
 
-	data := api.InteractionResponse{
+// respondEphemerally responds to an interaction with a message only the user who triggered it can see.
+func (bot *Bot) respondEphemerally(e *gateway.InteractionCreateEvent, content string) error {
+	return bot.responder(e).Respond(api.InteractionResponse{
 		Type: api.MessageInteractionWithSource,
 		Data: &api.InteractionResponseData{
-			Content: option.NewNullableString(fmt.Sprintf("Nice job! %s %s role 😊", message, roleName)),
+			Content: option.NewNullableString(content),
 			Flags:   api.EphemeralResponse,
 		},
+	})
+}
+
+// isNotFound returns true if err is a Discord API error saying that the thing
+// asked for doesn't exist (any more).
+func isNotFound(err error) bool {
+	var httpErr *httputil.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Status == http.StatusNotFound
+}
+
+// discordUnknownMember is the error code Discord gives when asked for a member of a
+// guild that the user isn't in.
+const discordUnknownMember = 10007
+
+// isUnknownMember returns true if err is a Discord API error saying that a user isn't a
+// member of the guild - as opposed to the bot failing to find out whether they are.
+func isUnknownMember(err error) bool {
+	var httpErr *httputil.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Code == discordUnknownMember
+}
+
+// isForbidden returns true if err is a Discord API error saying that the bot
+// isn't allowed to do what it asked.
+func isForbidden(err error) bool {
+	var httpErr *httputil.HTTPError
+	return errors.As(err, &httpErr) && httpErr.Status == http.StatusForbidden
+}
+
+// rateLimitWait checks whether err is a Discord API error saying that the bot
+// is being rate limited, returning how long Discord asked it to wait if so.
+func rateLimitWait(err error) (time.Duration, bool) {
+	var httpErr *httputil.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Status != http.StatusTooManyRequests {
+		return 0, false
 	}
 
-	if err := bot.State.RespondInteraction(e.ID, e.Token, data); err != nil {
-		log.Println("failed to send interaction callback for assigning user role interaction:", err)
-		return err
-	} else {
-		return nil
+	var body struct {
+		RetryAfter float64 `json:"retry_after"`
 	}
+	if json.Unmarshal(httpErr.Body, &body) != nil || body.RetryAfter <= 0 {
+		return time.Second, true
+	}
+	return time.Duration(body.RetryAfter * float64(time.Second)), true
 }
 
-// toggleUserRole internally assigns a user a role, or creates a role
-// and assigns it to the user if it did not already exist. It returns
-// a boolean indicating whether it assigned (true) or removed (false)
-// the role, and an error.
-func (bot *Bot) toggleUserRole(member *discord.Member, roleName string, guildID discord.GuildID, auditLogReason string) (bool, error) {
+// findRoleByName finds the role in a guild with the given name, with case
+// insensitive matching. It returns nil if there's no such role.
+func (bot *Bot) findRoleByName(guildID discord.GuildID, roleName string) (*discord.Role, error) {
 	roles, err := bot.State.Roles(guildID)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	var roleToUse *discord.Role
 	for _, role := range roles {
 		if strings.EqualFold(role.Name, roleName) {
-			roleToUse = &role
-			// Failing to break early from the loop here creates an issue where the pointer moves to the end of the list.
-			break
+			return &role, nil
 		}
 	}
 
-	if roleToUse == nil {
-		roleToUse, err = bot.State.CreateRole(guildID, api.CreateRoleData{
-			Name: roleName,
-		})
-		if err != nil {
-			return false, err
-		}
+	return nil, nil
+}
+
+// findOrCreateRole finds the role in a guild with the given name, creating it
+// if it doesn't exist yet.
+func (bot *Bot) findOrCreateRole(guildID discord.GuildID, roleName string) (*discord.Role, error) {
+	role, err := bot.findRoleByName(guildID, roleName)
+	if err != nil || role != nil {
+		return role, err
 	}
 
-	hasRole := false
-	for _, roleID := range member.RoleIDs {
-		if roleID == roleToUse.ID {
-			hasRole = true
-			break
+	role, err = bot.State.CreateRole(guildID, api.CreateRoleData{
+		Name: roleName,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	recordCreatedRole(guildID, role)
+	return role, nil
+}
+
+// toggleUserRole internally assigns a user a role, or creates a role
+// and assigns it to the user if it did not already exist. If role is
+// nil, the role is looked up by name. It returns a boolean indicating
+// whether it assigned (true) or removed (false) the role, the ID of
+// the role, and an error.
+func (bot *Bot) toggleUserRole(member *discord.Member, role *discord.Role, roleName string, guildID discord.GuildID, auditLogReason string) (bool, discord.RoleID, error) {
+	roleToUse := role
+	if roleToUse == nil {
+		var err error
+		roleToUse, err = bot.findOrCreateRole(guildID, roleName)
+		if err != nil {
+			return false, 0, err
 		}
 	}
 
-	if hasRole {
-		err = bot.State.RemoveRole(guildID, member.User.ID, roleToUse.ID, api.AuditLogReason(auditLogReason))
-		return false, err
+	if memberHasRole(member, roleToUse.ID) {
+		err := bot.State.RemoveRole(guildID, member.User.ID, roleToUse.ID, api.AuditLogReason(auditLogReason))
+		return false, roleToUse.ID, err
 	} else {
-		err = bot.State.AddRole(guildID, member.User.ID, roleToUse.ID, api.AddRoleData{
+		err := bot.State.AddRole(guildID, member.User.ID, roleToUse.ID, api.AddRoleData{
 			AuditLogReason: api.AuditLogReason(auditLogReason),
 		})
-		return true, err
+		return true, roleToUse.ID, err
 	}
 }
 
@@ -313,7 +356,7 @@ func (bot *Bot) VerifyUser(user discord.User, guildID discord.GuildID) error {
 			&discord.ActionRowComponent{
 				&discord.ButtonComponent{
 					Label:    "I've verified!",
-					CustomID: "verified_button",
+					CustomID: CustomID{Type: VerifiedButtonID}.Encode(),
 					Emoji: &discord.ComponentEmoji{
 						Name: "✔️",
 					},
@@ -331,7 +374,8 @@ func (bot *Bot) VerifyUser(user discord.User, guildID discord.GuildID) error {
 		if ok {
 			switch d := ci.Data.(type) {
 			case *discord.ButtonInteraction:
-				if ci.ChannelID == memberChannel.ID && ci.User.ID == user.ID && d.CustomID == "verified_button" {
+				id, err := DecodeCustomID(d.CustomID)
+				if err == nil && id.Type == VerifiedButtonID && ci.ChannelID == memberChannel.ID && ci.User.ID == user.ID {
 					interactionToRespondTo = ci
 					return true
 				}
@@ -487,10 +531,19 @@ func (bot *Bot) createReinviteMessage(guildID discord.GuildID, user discord.User
 	return &reinviteMessageData, nil
 }
 
-// getVerifiedRole gets either the cached or the new "verified" role for the server.
+// getVerifiedRole gets the verified role for the server - the one set up for it,
+// or failing that, either the cached or the new "verified" role.
 func (bot *Bot) getVerifiedRole(guildID discord.GuildID) (*discord.RoleID, error) {
+	if configured := currentConfig().Guilds[guildID].VerifiedRole; configured.IsValid() {
+		return &configured, nil
+	}
+
+	verifiedRolesMutex.Lock()
+	defer verifiedRolesMutex.Unlock()
+
 	if verifiedRoles[guildID] != nil {
-		return &verifiedRoles[guildID].ID, nil
+		roleID := verifiedRoles[guildID].ID
+		return &roleID, nil
 	}
 
 	roles, err := bot.State.Roles(guildID)
@@ -505,7 +558,20 @@ func (bot *Bot) getVerifiedRole(guildID discord.GuildID) (*discord.RoleID, error
 		}
 	}
 
-	return nil, fmt.Errorf("no verified role found on server %d! Please ensure that there is a role on the server called 'verified', with case insensitive", guildID)
+	return nil, fmt.Errorf("no verified role found on server %d! Please run /setup, or ensure that there is a role on the server called 'verified', with case insensitive", guildID)
+}
+
+// forgetVerifiedRole forgets the verified role found for a guild, so that it's looked up
+// again next time it's needed. If guildID isn't valid, every guild's is forgotten.
+func forgetVerifiedRole(guildID discord.GuildID) {
+	verifiedRolesMutex.Lock()
+	defer verifiedRolesMutex.Unlock()
+
+	if guildID.IsValid() {
+		delete(verifiedRoles, guildID)
+	} else {
+		verifiedRoles = map[discord.GuildID]*discord.Role{}
+	}
 }
 
 // getMemberTypeForGuild takes a guild ID and gets the type of
@@ -514,7 +580,7 @@ func getMemberTypeForGuild(guildID discord.GuildID) StudentType {
 	var memberType StudentType
 	memberType = &CurrentStudent{}
 
-	for configGuildID, guildConfig := range config.Guilds {
+	for configGuildID, guildConfig := range currentConfig().Guilds {
 		if guildID == configGuildID && guildConfig.AlumniGuild {
 			memberType = &Alumnus{}
 		}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state"
+	"github.com/joho/godotenv"
+)
+
+// cliCommand is a subcommand of the command line, like rainbot serve.
+type cliCommand struct {
+	Name        string
+	Description string
+	// Run parses the subcommand's flags from args, and runs it.
+	Run func(args []string) error
+}
+
+// cliCommands are the subcommands of the command line. The first is the default, run
+// when no subcommand is given.
+var cliCommands = []cliCommand{
+	{"serve", "Connects to Discord and runs the bot", runServe},
+	{"reap", "Deletes old messages from the channels configured to be reaped", runReap},
+	{"warn", "Messages members who aren't verified as their server needs, warning them they'll be removed", runWarn},
+	{"purge", "Removes members who aren't verified as their server needs", runPurge},
+	{"report", "Lists members who aren't verified as their server needs, without messaging them", runReport},
+	{"gc-roles", "Lists the roles the bot created, and deletes empty ones that aren't in the config", runGarbageRoles},
+	{"check-config", "Checks the config file for problems, and the guilds, channels and roles it refers to", runCheckConfig},
+}
+
+// legacyModeFlags maps the flags that used to choose what the bot did to the subcommands
+// that replaced them, so that existing cron jobs keep working.
+var legacyModeFlags = map[string]string{
+	"reaperMode":   "reap",
+	"warnInvalid":  "warn",
+	"purgeInvalid": "purge",
+	"gcRoles":      "gc-roles",
+	"checkConfig":  "check-config",
+}
+
+// legacyFlagNames maps the names of flags that have been renamed to their new names.
+var legacyFlagNames = map[string]string{
+	"warnInvalidDryRun":   "dry-run",
+	"warnInvalidDeadline": "deadline",
+	"devGuild":            "dev-guild",
+}
+
+// runCLI runs the subcommand named by the first of args with the rest of them.
+func runCLI(args []string) error {
+	args = translateLegacyArgs(args)
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return cliCommands[0].Run(args)
+	}
+
+	for _, command := range cliCommands {
+		if command.Name == args[0] {
+			return command.Run(args[1:])
+		}
+	}
+
+	if args[0] == "help" {
+		printUsage()
+		return nil
+	}
+
+	printUsage()
+	return fmt.Errorf("unknown command %q", args[0])
+}
+
+// translateLegacyArgs turns arguments using the flags from before there were subcommands
+// into the subcommand and flags that replaced them.
+func translateLegacyArgs(args []string) []string {
+	subcommand := ""
+	translated := []string{}
+	for _, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		value := ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i:]
+		}
+
+		if mode, ok := legacyModeFlags[name]; ok && strings.HasPrefix(arg, "-") {
+			// a mode that's turned off, like -reaperMode=false, never ran anything, so it's left out
+			if on, err := strconv.ParseBool(strings.TrimPrefix(value, "=")); value != "" && (err != nil || !on) {
+				log.Printf("Ignoring %s, as it doesn't turn the mode on", arg)
+				continue
+			}
+			log.Printf("-%s is deprecated - use rainbot %s instead", name, mode)
+			subcommand = mode
+			continue
+		}
+		if newName, ok := legacyFlagNames[name]; ok && strings.HasPrefix(arg, "-") {
+			log.Printf("-%s is deprecated - use --%s instead", name, newName)
+			arg = "--" + newName + value
+		}
+		translated = append(translated, arg)
+	}
+
+	if subcommand != "" {
+		translated = append([]string{subcommand}, translated...)
+	}
+	return translated
+}
+
+// printUsage prints how to use the command line.
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "Usage: rainbot <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, command := range cliCommands {
+		fmt.Fprintf(os.Stderr, "  %-13s %s\n", command.Name, command.Description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run rainbot <command> -h to see the flags a command takes.")
+}
+
+// cliOptions are the flags every subcommand takes.
+type cliOptions struct {
+	ConfigPath string
+	EnvPath    string
+}
+
+// newFlagSet creates the flag set for a subcommand, with the flags every subcommand takes.
+func newFlagSet(name string) (*flag.FlagSet, *cliOptions) {
+	options := &cliOptions{}
+	flags := flag.NewFlagSet("rainbot "+name, flag.ContinueOnError)
+	flags.StringVar(&options.ConfigPath, "config", "config.yml", "The config file to use.")
+	flags.StringVar(&options.EnvPath, "env", ".env", "The env file to load the environment from.")
+	return flags, options
+}
+
+// loadEnv loads the env file.
+func (options *cliOptions) loadEnv() error {
+	if err := godotenv.Load(options.EnvPath); err != nil {
+		return fmt.Errorf("failed loading env file %s: %w", options.EnvPath, err)
+	}
+	return nil
+}
+
+// load loads the env file and the config file, with the settings changed from Discord
+// applied on top.
+func (options *cliOptions) load() error {
+	if err := options.loadEnv(); err != nil {
+		return err
+	}
+
+	configPath = options.ConfigPath
+	fileConfig, err := readConfigFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed loading config file: %w", err)
+	}
+	setCurrentConfig(fileConfig)
+
+	if err := loadGuildConfigs(); err != nil {
+		return fmt.Errorf("failed loading guild configs: %w", err)
+	}
+	return nil
+}
+
+// newBot creates a bot with the token from $BOT_TOKEN.
+func newBot() (*Bot, error) {
+	token := os.Getenv("BOT_TOKEN")
+	if token == "" {
+		return nil, errors.New("no $BOT_TOKEN given")
+	}
+	return &Bot{State: state.New("Bot " + token)}, nil
+}
+
+// snowflakeListFlag is a flag that can be given several times, or with several IDs
+// separated by commas, to build up a list of IDs.
+type snowflakeListFlag []discord.Snowflake
+
+// String returns the IDs, separated by commas.
+func (f *snowflakeListFlag) String() string {
+	ids := make([]string, len(*f))
+	for i, id := range *f {
+		ids[i] = id.String()
+	}
+	return strings.Join(ids, ",")
+}
+
+// Set adds the IDs given to the list.
+func (f *snowflakeListFlag) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		id, err := discord.ParseSnowflake(strings.TrimSpace(part))
+		if err != nil || !id.IsValid() {
+			return fmt.Errorf("%q isn't a valid ID", part)
+		}
+		*f = append(*f, id)
+	}
+	return nil
+}
+
+// Contains checks whether the list contains an ID. An empty list contains everything.
+func (f snowflakeListFlag) Contains(id discord.Snowflake) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, listed := range f {
+		if listed == id {
+			return true
+		}
+	}
+	return false
+}
+
+// targetGuilds returns the configured guilds to run a subcommand for - those in guildIDs,
+// or every guild if it's empty. It's an error for guildIDs to name a guild that isn't
+// configured.
+func targetGuilds(guildIDs snowflakeListFlag) (map[discord.GuildID]GuildConfig, error) {
+	guilds := map[discord.GuildID]GuildConfig{}
+	for guildID, guildConfig := range currentConfig().Guilds {
+		if guildIDs.Contains(discord.Snowflake(guildID)) {
+			guilds[guildID] = guildConfig
+		}
+	}
+
+	for _, guildID := range guildIDs {
+		if _, ok := guilds[discord.GuildID(guildID)]; !ok {
+			return nil, fmt.Errorf("guild %s isn't in the config", guildID)
+		}
+	}
+	return guilds, nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTranslateLegacyArgs(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"no arguments", []string{}, []string{}},
+		{"subcommand", []string{"reap", "--guild", "1"}, []string{"reap", "--guild", "1"}},
+		{"mode flag", []string{"-reaperMode"}, []string{"reap"}},
+		{"mode flag with two dashes", []string{"--gcRoles"}, []string{"gc-roles"}},
+		{"mode flag with a value", []string{"--checkConfig=true"}, []string{"check-config"}},
+		{"mode flag turned off", []string{"-reaperMode=false"}, []string{}},
+		{"mode flag turned off after one turned on", []string{"-gcRoles", "-reaperMode=0", "--config", "other.yml"}, []string{"gc-roles", "--config", "other.yml"}},
+		{"mode flag with a value that isn't true or false", []string{"-purgeInvalid=maybe"}, []string{}},
+		{"mode flag after other flags", []string{"--config", "other.yml", "-purgeInvalid"}, []string{"purge", "--config", "other.yml"}},
+		{"renamed flags", []string{"-warnInvalid", "-warnInvalidDryRun", "-warnInvalidDeadline", "1 May"}, []string{"warn", "--dry-run", "--deadline", "1 May"}},
+		{"renamed flag with a value", []string{"-devGuild=123"}, []string{"--dev-guild=123"}},
+		{"flag values that look like legacy flags", []string{"--deadline", "reaperMode", "--config", "devGuild"}, []string{"--deadline", "reaperMode", "--config", "devGuild"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := translateLegacyArgs(test.args); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("translateLegacyArgs(%q) = %q, want %q", test.args, got, test.want)
+			}
+		})
+	}
+}
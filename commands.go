@@ -0,0 +1,427 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// maxAutocompleteChoices is the most suggestions Discord will show for an option.
+const maxAutocompleteChoices = 25
+
+// CommandHandler handles a command interaction from the dispatcher.
+type CommandHandler func(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error
+
+// AutocompleteHandler suggests values for an option that a member is partway through
+// typing, given every option they've filled in so far.
+type AutocompleteHandler func(bot *Bot, e *gateway.InteractionCreateEvent, options discord.AutocompleteOptions) ([]discord.StringChoice, error)
+
+// Command declares an application command the bot provides - what Discord needs to
+// register it, which capability members need to run it, and how to handle it.
+// Commands are slash commands unless their Type says they're a context menu command,
+// which appear when right clicking a member or message and have no description.
+// Commands with subcommands are handled by the subcommand used rather than Handler,
+// and Autocomplete maps the names of options to what suggests values for them.
+// Defer says how the command's deferred if it's slow, which is ephemerally unless it
+// replies publicly.
+type Command struct {
+	Type         discord.CommandType
+	Name         string
+	Description  string
+	Options      discord.CommandOptions
+	Subcommands  []Subcommand
+	Capability   Capability
+	Handler      CommandHandler
+	Defer        DeferKind
+	Autocomplete map[string]AutocompleteHandler
+}
+
+// Subcommand declares a subcommand of a command, like create in /picker create.
+type Subcommand struct {
+	Name        string
+	Description string
+	Options     []discord.CommandOptionValue
+	Handler     CommandHandler
+	Defer       DeferKind
+}
+
+// commands is the registry of every command the bot provides. Commands registered
+// with Discord that aren't in here are removed when the commands are synced.
+var commands = []Command{
+	{
+		Name:        "picker",
+		Description: "Posts and refreshes pickers - for committee only!",
+		Capability:  CapabilityPickers,
+		Subcommands: []Subcommand{
+			{
+				Name:        "create",
+				Description: "Posts a picker in the current channel",
+				Options: []discord.CommandOptionValue{
+					&discord.StringOption{
+						OptionName:  "kind",
+						Description: "What the picker is for",
+						Required:    true,
+						Choices: []discord.StringChoice{
+							{Name: "Verification", Value: string(VerificationPicker)},
+							{Name: "Pronouns", Value: string(PronounPicker)},
+							{Name: "Colours", Value: string(ColourPicker)},
+							{Name: "Roles", Value: string(RolePicker)},
+						},
+					},
+					&discord.StringOption{
+						OptionName:   "group",
+						Description:  "The role group to offer, for role pickers - leave empty for the main roles",
+						Autocomplete: true,
+					},
+					&discord.StringOption{
+						OptionName:   "role",
+						Description:  "Offer just this one role",
+						Autocomplete: true,
+					},
+					&discord.StringOption{
+						OptionName:  "title",
+						Description: "Text to show above the buttons, instead of the usual",
+					},
+				},
+				Handler: (*Bot).OnPickerCreateCommand,
+				// pickers are posted for everyone to use
+				Defer: DeferPublic,
+			},
+			{
+				Name:        "refresh",
+				Description: "Updates every picker in this server to match the current config",
+				Handler: func(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+					return bot.OnRefreshPickersCommand(e)
+				},
+			},
+		},
+		Autocomplete: map[string]AutocompleteHandler{
+			"group": (*Bot).autocompleteRoleGroup,
+			"role":  (*Bot).autocompletePickerRole,
+		},
+	},
+	{
+		Name:        "temprole",
+		Description: "Gives a member a role for a limited time - for committee only!",
+		Options: discord.CommandOptions{
+			&discord.UserOption{
+				OptionName:  "user",
+				Description: "The member to give the role to",
+				Required:    true,
+			},
+			&discord.RoleOption{
+				OptionName:  "role",
+				Description: "The role to give them",
+				Required:    true,
+			},
+			&discord.StringOption{
+				OptionName:  "duration",
+				Description: "How long they should have the role for, like 3h, 2d or 1w",
+				Required:    true,
+			},
+		},
+		Capability: CapabilityRoles,
+		Handler:    (*Bot).OnTempRoleCommand,
+	},
+	{
+		Name:        "gc_roles",
+		Description: "Lists roles the bot created, and offers to delete empty unused ones - for committee only!",
+		Capability:  CapabilityMaintenance,
+		Handler: func(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+			return bot.OnGarbageRolesCommand(e)
+		},
+	},
+	{
+		Name:        "jobs",
+		Description: "Shows and runs the bot's scheduled jobs - for the bot's owner only!",
+		Capability:  CapabilityMaintenance,
+		Subcommands: []Subcommand{
+			{
+				Name:        "list",
+				Description: "Shows when each job runs, and how its latest runs went",
+				Handler:     (*Bot).OnJobsListCommand,
+			},
+			{
+				Name:        "run",
+				Description: "Runs a job straight away",
+				Options: []discord.CommandOptionValue{
+					&discord.StringOption{
+						OptionName:  "job",
+						Description: "The job to run",
+						Required:    true,
+						Choices:     jobChoices(),
+					},
+				},
+				Handler: (*Bot).OnJobsRunCommand,
+			},
+		},
+	},
+	{
+		Name:        "reaper",
+		Description: "Shows what the reaper does - for committee only!",
+		Capability:  CapabilitySetup,
+		Subcommands: []Subcommand{
+			{
+				Name:        "preview",
+				Description: "Shows what reaping a channel would delete, without deleting anything",
+				Options: []discord.CommandOptionValue{
+					&discord.ChannelOption{
+						OptionName:   "channel",
+						Description:  "The channel to preview reaping",
+						Required:     true,
+						ChannelTypes: []discord.ChannelType{discord.GuildText, discord.GuildNews, GuildForum},
+					},
+					&discord.StringOption{
+						OptionName:  "duration",
+						Description: "How long the channel would keep messages for, like 7d - if not how long it does now",
+					},
+				},
+				Handler: (*Bot).OnReaperPreviewCommand,
+			},
+		},
+	},
+	{
+		Name:        "setup",
+		Description: "Sets up the bot for this server, step by step - for committee only!",
+		Capability:  CapabilitySetup,
+		Handler: func(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+			return bot.OnSetupCommand(e)
+		},
+	},
+	{
+		Name:        "config",
+		Description: "Shows and changes how the bot is set up for this server - for committee only!",
+		Capability:  CapabilitySetup,
+		Subcommands: []Subcommand{
+			{
+				Name:        "get",
+				Description: "Shows a setting",
+				Options: []discord.CommandOptionValue{
+					&discord.StringOption{
+						OptionName:  "setting",
+						Description: "The setting to show",
+						Required:    true,
+						Choices:     configSettingChoices(),
+					},
+				},
+				Handler: (*Bot).OnConfigGetCommand,
+			},
+			{
+				Name:        "set",
+				Description: "Changes a setting",
+				Options: []discord.CommandOptionValue{
+					&discord.StringOption{
+						OptionName:  "setting",
+						Description: "The setting to change",
+						Required:    true,
+						Choices:     configSettingChoices(),
+					},
+					&discord.StringOption{
+						OptionName:  "value",
+						Description: "The new value - use /config get to see the current one",
+						Required:    true,
+					},
+				},
+				Handler: (*Bot).OnConfigSetCommand,
+			},
+			{
+				Name:        "list",
+				Description: "Shows every setting",
+				Handler:     (*Bot).OnConfigListCommand,
+			},
+			{
+				Name:        "history",
+				Description: "Shows recent changes to the settings",
+				Handler:     (*Bot).OnConfigHistoryCommand,
+			},
+		},
+	},
+	{
+		Type:       discord.UserCommand,
+		Name:       "Verification status",
+		Capability: CapabilityVerification,
+		Handler:    (*Bot).OnVerificationStatusCommand,
+	},
+	{
+		Type:       discord.UserCommand,
+		Name:       "Re-send verification DM",
+		Capability: CapabilityVerification,
+		Handler:    (*Bot).OnResendVerificationCommand,
+	},
+	{
+		Type:       discord.UserCommand,
+		Name:       "Manually verify",
+		Capability: CapabilityVerification,
+		Handler:    (*Bot).OnManuallyVerifyCommand,
+	},
+	{
+		Type:       discord.MessageCommand,
+		Name:       "Report message",
+		Capability: CapabilityReport,
+		Handler:    (*Bot).OnReportMessageCommand,
+	},
+}
+
+// findCommand finds the command in the registry with the given type and name, or returns nil if there isn't one.
+func findCommand(commandType discord.CommandType, name string) *Command {
+	for i := range commands {
+		if commands[i].commandType() == commandType && commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// Run handles a command interaction for the command. If the command has subcommands,
+// it's handled by the subcommand used, which sees that subcommand's options as the
+// interaction's options.
+func (c Command) Run(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	if len(c.Subcommands) == 0 {
+		return c.Handler(bot, e, data)
+	}
+
+	if len(data.Options) == 0 {
+		return fmt.Errorf("command %s used without a subcommand", c.Name)
+	}
+
+	for _, subcommand := range c.Subcommands {
+		if subcommand.Name == data.Options[0].Name {
+			subcommandData := *data
+			subcommandData.Options = data.Options[0].Options
+			return subcommand.Handler(bot, e, &subcommandData)
+		}
+	}
+
+	return fmt.Errorf("command %s has no subcommand %s", c.Name, data.Options[0].Name)
+}
+
+// deferKind returns how a command interaction is deferred - by the subcommand used, if
+// the command has subcommands.
+func (c Command) deferKind(data *discord.CommandInteraction) DeferKind {
+	if len(c.Subcommands) == 0 || len(data.Options) == 0 {
+		return c.Defer
+	}
+	for _, subcommand := range c.Subcommands {
+		if subcommand.Name == data.Options[0].Name {
+			return subcommand.Defer
+		}
+	}
+	return c.Defer
+}
+
+// Complete suggests values for the option being typed into in an autocomplete interaction
+// for the command, filtered to those containing what's been typed so far.
+func (c Command) Complete(bot *Bot, e *gateway.InteractionCreateEvent, data *discord.AutocompleteInteraction) (api.AutocompleteStringChoices, error) {
+	options := data.Options
+	// subcommands' options are nested inside them
+	if len(c.Subcommands) > 0 && len(options) > 0 {
+		options = options[0].Options
+	}
+
+	var focused discord.AutocompleteOption
+	for _, option := range options {
+		if option.Focused {
+			focused = option
+		}
+	}
+
+	handler, ok := c.Autocomplete[focused.Name]
+	if !ok {
+		return api.AutocompleteStringChoices{}, nil
+	}
+
+	suggestions, err := handler(bot, e, options)
+	if err != nil {
+		return nil, err
+	}
+
+	typed := strings.ToLower(focused.String())
+	choices := api.AutocompleteStringChoices{}
+	for _, suggestion := range suggestions {
+		if len(choices) == maxAutocompleteChoices {
+			break
+		}
+		if strings.Contains(strings.ToLower(suggestion.Name), typed) {
+			choices = append(choices, suggestion)
+		}
+	}
+	return choices, nil
+}
+
+// commandType returns the type of the command, defaulting to a slash command.
+func (c Command) commandType() discord.CommandType {
+	if c.Type == 0 {
+		return discord.ChatInputCommand
+	}
+	return c.Type
+}
+
+// commandInteractionType works out which type of command an interaction is for. Discord
+// sends this, but arikawa doesn't decode it, so it's inferred from what was targeted.
+func commandInteractionType(data *discord.CommandInteraction) discord.CommandType {
+	if !data.TargetID.IsValid() {
+		return discord.ChatInputCommand
+	}
+	if _, ok := data.Resolved.Messages[data.TargetMessageID()]; ok {
+		return discord.MessageCommand
+	}
+	return discord.UserCommand
+}
+
+// createCommandData turns the command registry into the data Discord needs to register the commands.
+func createCommandData() []api.CreateCommandData {
+	data := make([]api.CreateCommandData, len(commands))
+	for i, command := range commands {
+		data[i] = api.CreateCommandData{
+			Type:           command.commandType(),
+			Name:           command.Name,
+			Description:    command.Description,
+			Options:        command.Options,
+			NoDMPermission: true,
+		}
+
+		for _, subcommand := range command.Subcommands {
+			data[i].Options = append(data[i].Options, &discord.SubcommandOption{
+				OptionName:  subcommand.Name,
+				Description: subcommand.Description,
+				Options:     subcommand.Options,
+			})
+		}
+
+		// commands that everyone can use are left for anyone to see
+		if defaultPermissions := capabilityDefaultPermissions[command.Capability]; defaultPermissions != 0 {
+			data[i].DefaultMemberPermissions = &defaultPermissions
+		}
+	}
+	return data
+}
+
+// SyncCommands registers the command registry with Discord, overwriting whatever was
+// registered before so that removed commands disappear. If devGuildID is valid, the
+// commands are registered to just that guild, where changes show up instantly,
+// rather than globally, where they can take up to an hour to propagate. Global commands
+// are left alone then, in case the bot is also running in production, so they show up
+// twice in that guild.
+func (bot *Bot) SyncCommands(appID discord.AppID, devGuildID discord.GuildID) error {
+	var registered []discord.Command
+	var err error
+
+	if devGuildID.IsValid() {
+		registered, err = bot.State.BulkOverwriteGuildCommands(appID, devGuildID, createCommandData())
+		if global, globalErr := bot.State.Commands(appID); globalErr == nil && len(global) > 0 {
+			log.Println("There are also", len(global), "global commands registered, so commands will show up twice in guild", devGuildID)
+		}
+	} else {
+		registered, err = bot.State.BulkOverwriteCommands(appID, createCommandData())
+	}
+	if err != nil {
+		return err
+	}
+
+	log.Println("Synced", len(registered), "commands")
+	return nil
+}
@@ -1,80 +1,393 @@
 package main
 
 import (
-	"flag"
+	"fmt"
 	"io/ioutil"
-	"log"
+	"regexp"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/diamondburned/arikawa/v3/discord"
-	"github.com/joho/godotenv"
-	"gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
 )
 
-// config stores the bot configuration.
-var config Config = Config{}
+// configPath is the config file the bot is configured from, set with --config.
+var configPath = "config.yml"
 
-// reaperMode is true when the bot is being launched to delete old messages.
-var reaperMode bool
+// config stores the bot configuration in use. It's replaced as a whole when the config
+// is reloaded, so read it with currentConfig rather than holding on to it.
+var config atomic.Value
 
-// warnInvalidMode is true when the bot is being launched to warn users who are invalid of their pending removal.
-var warnInvalidMode bool
-
-// warnInvalidDryRunMode is true when the bot is in warnInvalid mode, but should not send any messages - just print the usernames to the console.
-var warnInvalidDryRunMode bool
-
-// warnInvalidDeadline sets a time when members should expect to be removed in an invalid member warning.
-var warnInvalidDeadline string
-
-// purgeInvalidMode is true when the bot is being launched to remove unsuitably-verified users.
-var purgeInvalidMode bool
-
-// init sets up our command line flags, loads our env file, and loads our config file.
-func init() {
-	flag.BoolVar(&reaperMode, "reaperMode", false, "Sets the bot to be in reaper mode.")
-	flag.BoolVar(&warnInvalidMode, "warnInvalid", false, "Sets the bot to be in 'invalid user' warning mode.")
-	flag.BoolVar(&warnInvalidDryRunMode, "warnInvalidDryRun", false, "Sets the bot to not message invalid users, but just print names to the console.")
-	flag.StringVar(&warnInvalidDeadline, "warnInvalidDeadline", "a few days", "Sets a string to use as a timeframe for members to expect to be removed.")
-	flag.BoolVar(&purgeInvalidMode, "purgeInvalid", false, "Sets the bot to be in 'invalid user' purging mode.")
+// currentConfig returns the bot configuration in use. It must not be changed - make
+// changes to a copy and swap it in with setCurrentConfig.
+func currentConfig() Config {
+	c, _ := config.Load().(Config)
+	return c
+}
 
-	err := godotenv.Load(".env")
+// setCurrentConfig replaces the bot configuration in use.
+func setCurrentConfig(c Config) {
+	config.Store(c)
+}
 
+// readConfigFile reads and parses a config file, and checks that it's valid.
+func readConfigFile(path string) (Config, error) {
+	configfile, err := ioutil.ReadFile(path)
 	if err != nil {
-		log.Fatal("Error loading .env file")
+		return Config{}, err
 	}
 
-	flag.Parse()
-
-	configfile, err := ioutil.ReadFile("config.yml") // the file is inside the local directory
-	if err != nil {
-		log.Fatalln("Failed loading config file:", err)
+	var c Config
+	if err := yaml.Unmarshal(configfile, &c); err != nil {
+		return Config{}, fmt.Errorf("failed parsing %s: %w", path, err)
 	}
 
-	err = yaml.Unmarshal(configfile, &config)
-	if err != nil {
-		log.Fatalln("Failed parsing config file:", err)
+	if err := validateConfig(c); err != nil {
+		return Config{}, fmt.Errorf("%s is invalid: %w", path, err)
 	}
-
-	// log.Println(config)
+	return c, nil
 }
 
 // Config holds the overall application configuration.
 type Config struct {
 	// maps guild IDs to configs
-	Guilds   map[discord.GuildID]GuildConfig
+	Guilds   GuildConfigs
 	Pronouns []string
+	// Jobs maps the names of scheduled jobs (see scheduler.go) to when they should run.
+	Jobs map[string]JobConfig
+}
+
+// GuildPronouns returns the pronouns offered by a guild's pronoun picker - its own, if it
+// has any, or else the ones offered by every guild.
+func (c Config) GuildPronouns(guildID discord.GuildID) []string {
+	if pronouns := c.Guilds[guildID].Pronouns; len(pronouns) > 0 {
+		return pronouns
+	}
+	return c.Pronouns
+}
+
+// JobConfig says when a scheduled job runs - either every so often, or on a cron
+// schedule, like "0 3 * * *" for 3am every day.
+type JobConfig struct {
+	Every Duration `yaml:"every" json:"every,omitempty"`
+	Cron  string   `yaml:"cron" json:"cron,omitempty"`
+	// Jitter, if set, delays each run by a random amount of time up to it, so that runs
+	// don't all hit Discord at the same moment.
+	Jitter Duration `yaml:"jitter" json:"jitter,omitempty"`
+	// Deadline is when members warned by the warn job should expect to be removed.
+	Deadline string `yaml:"deadline" json:"deadline,omitempty"`
+}
+
+// GuildConfigs maps guild IDs to configs. In the config file, it can either be written
+// as a mapping from IDs to configs, or as a list of configs that each have a guildID.
+type GuildConfigs map[discord.GuildID]GuildConfig
+
+// UnmarshalYAML allows GuildConfigs to be given as either a mapping or a list. Like the
+// other UnmarshalYAML methods here, it takes unmarshal rather than a yaml.Node so that
+// the decoder's options, and the problems it finds, carry through to what's inside.
+func (g *GuildConfigs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if !isYAMLList(unmarshal) {
+		return unmarshal((*map[discord.GuildID]GuildConfig)(g))
+	}
+
+	var list []struct {
+		GuildID     discord.GuildID `yaml:"guildID"`
+		GuildConfig `yaml:",inline"`
+	}
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*g = GuildConfigs{}
+	for _, item := range list {
+		if !item.GuildID.IsValid() {
+			return yamlError(unmarshal, "every guild in the list of guilds needs a guildID")
+		}
+		(*g)[item.GuildID] = item.GuildConfig
+	}
+	return nil
 }
 
 // GuildConfig holds configuration for a specific guild.
 type GuildConfig struct {
-	AlumniGuild bool `yaml:"alumniGuild"`
+	AlumniGuild bool `yaml:"alumniGuild" json:"alumniGuild"`
+	// VerifiedRole is the role given to verified members. If it isn't set, the role called "verified" is used.
+	VerifiedRole discord.RoleID `yaml:"verifiedRole" json:"verifiedRole,omitempty"`
 	// maps channel IDs to configs
-	Channels map[discord.GuildID]ChannelConfig
-	Colours  []string
-	Roles    []string
+	Channels ChannelConfigs `yaml:"channels" json:"channels,omitempty"`
+	Colours  []string       `yaml:"colours" json:"colours,omitempty"`
+	// Pronouns, if set, replaces the pronouns offered by the guild's pronoun picker.
+	Pronouns []string `yaml:"pronouns" json:"pronouns,omitempty"`
+	// Categories maps category IDs to how the channels in them are reaped, unless they're in Channels.
+	Categories CategoryConfigs `yaml:"categories" json:"categories,omitempty"`
+	// Reaper, if set, is how every other channel in the guild is reaped.
+	Reaper *ChannelConfig `yaml:"reaper" json:"reaper,omitempty"`
+	// ExcludeChannels are channels, and categories of channels, that Categories and Reaper never reap.
+	ExcludeChannels []discord.ChannelID `yaml:"excludeChannels" json:"excludeChannels,omitempty"`
+	// CustomColours adds a button to colour pickers that lets members type in their own hex colour.
+	CustomColours bool         `yaml:"customColours" json:"customColours,omitempty"`
+	Roles         []RoleConfig `yaml:"roles" json:"roles,omitempty"`
+	// RoleGroups maps names to extra lists of roles, that role pickers can be posted with instead of Roles.
+	RoleGroups map[string][]RoleConfig `yaml:"roleGroups" json:"roleGroups,omitempty"`
+	// Permissions maps capabilities to the roles and Discord permissions that grant them to committee members.
+	Permissions map[Capability]CapabilityGrant `yaml:"permissions" json:"permissions,omitempty"`
+	// ReportChannel is the channel that messages reported by members are posted to.
+	ReportChannel discord.ChannelID `yaml:"reportChannel" json:"reportChannel,omitempty"`
+	// ReaperLogChannel is the channel that summaries of what the reaper did are posted to.
+	ReaperLogChannel discord.ChannelID `yaml:"reaperLogChannel" json:"reaperLogChannel,omitempty"`
+}
+
+// clone returns a copy of the guild config that shares nothing with the original,
+// so that it can be changed without affecting the config in use.
+func (g GuildConfig) clone() GuildConfig {
+	c := g
+	c.Colours = append([]string(nil), g.Colours...)
+	c.Pronouns = append([]string(nil), g.Pronouns...)
+	c.Roles = append([]RoleConfig(nil), g.Roles...)
+
+	c.Channels = map[discord.ChannelID]ChannelConfig{}
+	for channelID, channelConfig := range g.Channels {
+		c.Channels[channelID] = channelConfig
+	}
+
+	c.Categories = map[discord.ChannelID]ChannelConfig{}
+	for categoryID, channelConfig := range g.Categories {
+		c.Categories[categoryID] = channelConfig
+	}
+	if g.Reaper != nil {
+		reaper := *g.Reaper
+		c.Reaper = &reaper
+	}
+	c.ExcludeChannels = append([]discord.ChannelID(nil), g.ExcludeChannels...)
+
+	c.RoleGroups = map[string][]RoleConfig{}
+	for name, roles := range g.RoleGroups {
+		c.RoleGroups[name] = append([]RoleConfig(nil), roles...)
+	}
+
+	c.Permissions = map[Capability]CapabilityGrant{}
+	for capability, grant := range g.Permissions {
+		c.Permissions[capability] = grant
+	}
+
+	return c
+}
+
+// RoleConfig holds configuration for a role offered by the generic role picker.
+// In the config file, it can either be written as just the role's name, or as
+// a mapping when the role has prerequisites.
+type RoleConfig struct {
+	Name string `yaml:"name" json:"name"`
+	// RequiresVerified means only members holding the verified role can take this role.
+	RequiresVerified bool `yaml:"requiresVerified" json:"requiresVerified,omitempty"`
+	// StudentType, if set, is the name of the type of student (see roles.go) a member must be authenticated as to take this role.
+	StudentType string `yaml:"studentType" json:"studentType,omitempty"`
+	// ConflictsWith lists the names of roles that a member can't hold at the same time as this role.
+	ConflictsWith []string `yaml:"conflictsWith" json:"conflictsWith,omitempty"`
+	// Duration, if set, is how long the role lasts once picked before it's automatically removed.
+	Duration Duration `yaml:"duration" json:"duration,omitempty"`
+}
+
+// UnmarshalYAML allows a RoleConfig to be given as either a plain role name or a full mapping.
+func (r *RoleConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*r = RoleConfig{Name: name}
+		return nil
+	}
+
+	type rawRoleConfig RoleConfig
+	return unmarshal((*rawRoleConfig)(r))
+}
+
+// AllRoles returns every role offered by the guild's role pickers, from Roles and every one of RoleGroups.
+func (g GuildConfig) AllRoles() []RoleConfig {
+	roles := append([]RoleConfig{}, g.Roles...)
+	for _, group := range g.RoleGroups {
+		roles = append(roles, group...)
+	}
+	return roles
+}
+
+// RoleGroup returns the roles in the named role group, or Roles if name is empty.
+// The second return is false if there's no such group.
+func (g GuildConfig) RoleGroup(name string) ([]RoleConfig, bool) {
+	if name == "" {
+		return g.Roles, true
+	}
+	roles, ok := g.RoleGroups[name]
+	return roles, ok
+}
+
+// RoleNames returns the names of each role in the role config list given.
+func RoleNames(roles []RoleConfig) []string {
+	names := make([]string, len(roles))
+	for i, role := range roles {
+		names[i] = role.Name
+	}
+	return names
+}
+
+// isYAMLList checks whether the value being unmarshalled is a list.
+func isYAMLList(unmarshal func(interface{}) error) bool {
+	var value interface{}
+	if err := unmarshal(&value); err != nil {
+		return false
+	}
+	_, ok := value.([]interface{})
+	return ok
+}
+
+// yamlError returns an error about the value being unmarshalled that says which line
+// it's on, in the same form as yaml.v3's own errors, so that decoding carries on past it
+// to find any other problems with the file.
+func yamlError(unmarshal func(interface{}) error, format string, args ...interface{}) error {
+	var line yamlLine
+	if err := unmarshal(&line); err != nil {
+		return err
+	}
+	return &yaml.TypeError{Errors: []string{fmt.Sprintf("line %d: %s", line, fmt.Sprintf(format, args...))}}
+}
+
+// yamlLine is the line a YAML value is on, for unmarshalling into to find out where the
+// value being unmarshalled is.
+type yamlLine int
+
+// UnmarshalYAML records the line the value is on.
+func (l *yamlLine) UnmarshalYAML(node *yaml.Node) error {
+	*l = yamlLine(node.Line)
+	return nil
+}
+
+// ChannelConfigs maps channel IDs to configs. Like GuildConfigs, it can be written as
+// either a mapping or a list of configs that each have a channelID.
+type ChannelConfigs map[discord.ChannelID]ChannelConfig
+
+// UnmarshalYAML allows ChannelConfigs to be given as either a mapping or a list.
+func (c *ChannelConfigs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if !isYAMLList(unmarshal) {
+		return unmarshal((*map[discord.ChannelID]ChannelConfig)(c))
+	}
+
+	var list []struct {
+		ChannelID     discord.ChannelID `yaml:"channelID"`
+		ChannelConfig `yaml:",inline"`
+	}
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*c = ChannelConfigs{}
+	for _, item := range list {
+		if !item.ChannelID.IsValid() {
+			return yamlError(unmarshal, "every channel in the list of channels needs a channelID")
+		}
+		(*c)[item.ChannelID] = item.ChannelConfig
+	}
+	return nil
+}
+
+// CategoryConfigs maps category IDs to how the channels in them are reaped. Like
+// ChannelConfigs, it can be written as either a mapping or a list of configs that each
+// have a categoryID.
+type CategoryConfigs map[discord.ChannelID]ChannelConfig
+
+// UnmarshalYAML allows CategoryConfigs to be given as either a mapping or a list.
+func (c *CategoryConfigs) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	if !isYAMLList(unmarshal) {
+		return unmarshal((*map[discord.ChannelID]ChannelConfig)(c))
+	}
+
+	var list []struct {
+		CategoryID    discord.ChannelID `yaml:"categoryID"`
+		ChannelConfig `yaml:",inline"`
+	}
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+
+	*c = CategoryConfigs{}
+	for _, item := range list {
+		if !item.CategoryID.IsValid() {
+			return yamlError(unmarshal, "every category in the list of categories needs a categoryID")
+		}
+		(*c)[item.CategoryID] = item.ChannelConfig
+	}
+	return nil
 }
 
 // ChannelConfig holds configuration for a specific channel in a guild.
 type ChannelConfig struct {
-	ReapDuration time.Duration `yaml:"reapDuration"`
+	// ReapDuration is how long messages are kept in the channel before they're deleted.
+	ReapDuration Duration `yaml:"reapDuration" json:"reapDuration"`
+	// Archive saves messages to the archive in the data directory before they're deleted.
+	Archive bool `yaml:"archive" json:"archive,omitempty"`
+	// ArchiveRetention, if set, is how long the channel's archive files are kept for.
+	ArchiveRetention Duration `yaml:"archiveRetention" json:"archiveRetention,omitempty"`
+	// Keep says which messages other than pinned ones are never reaped.
+	Keep KeepRules `yaml:"keep" json:"keep"`
+	// StaleThreads is what's done with threads and forum posts in the channel that have had
+	// no messages for longer than ReapDuration - "lock", "delete", or nothing if unset.
+	StaleThreads string `yaml:"staleThreads" json:"staleThreads,omitempty"`
+	// OnlyRoles, if set, limits reaping to messages by members holding any of these roles.
+	OnlyRoles []discord.RoleID `yaml:"onlyRoles" json:"onlyRoles,omitempty"`
+}
+
+// Duration is a time.Duration that can also be written in days or weeks in the config file, e.g. "7d" or "2w".
+type Duration time.Duration
+
+// UnmarshalYAML parses a Duration with parseDuration.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	parsed, err := parseDuration(s)
+	if err != nil {
+		return yamlError(unmarshal, "%q isn't a valid duration - try something like 12h, 7d or 2w", s)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// dayWeekDurationUnit matches a day or week component of a duration string.
+var dayWeekDurationUnit = regexp.MustCompile(`(\d+(?:\.\d+)?)([dw])`)
+
+// parseDuration parses a duration in the same way as time.ParseDuration, but also
+// accepts days ("d") and weeks ("w") as units - for example "1w2d12h".
+func parseDuration(s string) (time.Duration, error) {
+	var convertErr error
+	converted := dayWeekDurationUnit.ReplaceAllStringFunc(s, func(component string) string {
+		parts := dayWeekDurationUnit.FindStringSubmatch(component)
+
+		amount, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			convertErr = err
+			return component
+		}
+
+		hours := amount * 24
+		if parts[2] == "w" {
+			hours *= 7
+		}
+
+		return strconv.FormatFloat(hours, 'f', -1, 64) + "h"
+	})
+	if convertErr != nil {
+		return 0, convertErr
+	}
+
+	return time.ParseDuration(converted)
+}
+
+// formatDuration formats a duration so that parseDuration can read it back, in days
+// if it's a whole number of them.
+func formatDuration(d time.Duration) string {
+	if d > 0 && d%(24*time.Hour) == 0 {
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	}
+	return d.String()
 }
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigProblem is something wrong with a config file, and the line it's on - or zero
+// if it isn't about one line in particular.
+type ConfigProblem struct {
+	Line    int
+	Message string
+}
+
+// configReferenceKind is the kind of Discord object a config file refers to.
+type configReferenceKind string
+
+const (
+	guildReference   configReferenceKind = "guild"
+	channelReference configReferenceKind = "channel"
+	roleReference    configReferenceKind = "role"
+)
+
+// configReference is a guild, channel or role that a config file refers to, so that
+// it can be checked against Discord once the file is known to be well formed.
+type configReference struct {
+	Line    int
+	Kind    configReferenceKind
+	GuildID discord.GuildID
+	ID      discord.Snowflake
+}
+
+// checkConfig checks the config file at path and logs every problem found with it.
+// If token isn't empty, it's used to check that the guilds, channels and roles the
+// config refers to exist. It returns whether the config is free of problems.
+func checkConfig(path string, token string) bool {
+	problems, references, err := checkConfigFile(path)
+	if err != nil {
+		log.Println("Failed checking config file:", err)
+		return false
+	}
+
+	if len(problems) == 0 {
+		if token == "" {
+			log.Println("No $BOT_TOKEN given, so not checking the guilds, channels and roles the config refers to")
+		} else {
+			bot := Bot{State: state.New("Bot " + token)}
+			problems = bot.checkConfigReferences(references)
+		}
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+	for _, problem := range problems {
+		if problem.Line == 0 {
+			log.Printf("%s: %s", path, problem.Message)
+		} else {
+			log.Printf("%s:%d: %s", path, problem.Line, problem.Message)
+		}
+	}
+
+	if len(problems) > 0 {
+		log.Println("Found", len(problems), "problems with", path)
+		return false
+	}
+
+	log.Println(path, "looks good")
+	return true
+}
+
+// yamlProblem matches a problem yaml.v3 found with a file, and the line it's on.
+var yamlProblem = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+
+// unknownYAMLField matches yaml.v3's complaint about a key that isn't in the config
+// structures, which names the Go type rather than anything in the file.
+var unknownYAMLField = regexp.MustCompile(`^field (.*) not found in type .*$`)
+
+// newConfigProblem makes a ConfigProblem from a problem yaml.v3 found, picking out the
+// line it's on.
+func newConfigProblem(message string) ConfigProblem {
+	parts := yamlProblem.FindStringSubmatch(message)
+	if parts == nil {
+		return ConfigProblem{Message: strings.TrimPrefix(message, "yaml: ")}
+	}
+
+	line, _ := strconv.Atoi(parts[1])
+	message = parts[2]
+	if field := unknownYAMLField.FindStringSubmatch(message); field != nil {
+		message = fmt.Sprintf("unknown key %q", field[1])
+	}
+	return ConfigProblem{line, message}
+}
+
+// checkConfigFile checks the config file at path by loading it as the bot would, except
+// that keys the config structures don't have are problems rather than being ignored. It
+// returns the problems it finds, and the guilds, channels and roles the file refers to.
+func checkConfigFile(path string) ([]ConfigProblem, []configReference, error) {
+	configfile, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(configfile, &document); err != nil {
+		return []ConfigProblem{newConfigProblem(err.Error())}, nil, nil
+	}
+	if len(document.Content) == 0 {
+		return []ConfigProblem{{Message: "the file is empty"}}, nil, nil
+	}
+
+	var c Config
+	decoder := yaml.NewDecoder(bytes.NewReader(configfile))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil {
+		typeErr, ok := err.(*yaml.TypeError)
+		if !ok {
+			return []ConfigProblem{newConfigProblem(err.Error())}, nil, nil
+		}
+		problems := make([]ConfigProblem, len(typeErr.Errors))
+		for i, message := range typeErr.Errors {
+			problems[i] = newConfigProblem(message)
+		}
+		return problems, nil, nil
+	}
+
+	problems := []ConfigProblem{}
+	for _, problem := range configProblems(c) {
+		problems = append(problems, ConfigProblem{Message: problem})
+	}
+	return problems, configReferences(c, scalarLines(&document)), nil
+}
+
+// configReferences lists the guilds, channels and roles a config refers to, each with
+// the line it's first mentioned on.
+func configReferences(c Config, lines map[string]int) []configReference {
+	references := []configReference{}
+	add := func(kind configReferenceKind, guildID discord.GuildID, id discord.Snowflake) {
+		if id.IsValid() {
+			references = append(references, configReference{lines[id.String()], kind, guildID, id})
+		}
+	}
+	addChannel := func(guildID discord.GuildID, channelConfig ChannelConfig) {
+		for _, roleID := range channelConfig.Keep.Roles {
+			add(roleReference, guildID, discord.Snowflake(roleID))
+		}
+		for _, roleID := range channelConfig.OnlyRoles {
+			add(roleReference, guildID, discord.Snowflake(roleID))
+		}
+	}
+
+	for guildID, guildConfig := range c.Guilds {
+		add(guildReference, guildID, discord.Snowflake(guildID))
+		add(roleReference, guildID, discord.Snowflake(guildConfig.VerifiedRole))
+		add(channelReference, guildID, discord.Snowflake(guildConfig.ReportChannel))
+		add(channelReference, guildID, discord.Snowflake(guildConfig.ReaperLogChannel))
+
+		for channelID, channelConfig := range guildConfig.Channels {
+			add(channelReference, guildID, discord.Snowflake(channelID))
+			addChannel(guildID, channelConfig)
+		}
+		for categoryID, channelConfig := range guildConfig.Categories {
+			add(channelReference, guildID, discord.Snowflake(categoryID))
+			addChannel(guildID, channelConfig)
+		}
+		if guildConfig.Reaper != nil {
+			addChannel(guildID, *guildConfig.Reaper)
+		}
+		for _, channelID := range guildConfig.ExcludeChannels {
+			add(channelReference, guildID, discord.Snowflake(channelID))
+		}
+		for _, grant := range guildConfig.Permissions {
+			for _, roleID := range grant.Roles {
+				add(roleReference, guildID, discord.Snowflake(roleID))
+			}
+		}
+	}
+
+	sort.SliceStable(references, func(i, j int) bool { return references[i].Line < references[j].Line })
+	return references
+}
+
+// scalarLines maps each single value in a YAML document to the first line it's on.
+func scalarLines(node *yaml.Node) map[string]int {
+	lines := map[string]int{}
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		if node.Kind == yaml.ScalarNode {
+			if _, seen := lines[node.Value]; !seen {
+				lines[node.Value] = node.Line
+			}
+		}
+		for _, child := range node.Content {
+			walk(child)
+		}
+	}
+	walk(node)
+	return lines
+}
+
+// checkConfigReferences checks that the guilds, channels and roles a config file refers
+// to exist, and that channels and roles are in the guilds they're configured for.
+func (bot *Bot) checkConfigReferences(references []configReference) []ConfigProblem {
+	problems := []ConfigProblem{}
+	missingGuilds := map[discord.GuildID]bool{}
+
+	// guilds are checked first, so that channels and roles in missing guilds aren't reported too
+	sort.SliceStable(references, func(i, j int) bool {
+		return references[i].Kind == guildReference && references[j].Kind != guildReference
+	})
+
+	for _, reference := range references {
+		switch reference.Kind {
+		case guildReference:
+			if _, err := bot.State.Guild(reference.GuildID); err != nil {
+				missingGuilds[reference.GuildID] = true
+				problems = append(problems, ConfigProblem{reference.Line, fmt.Sprintf("the bot can't see guild %s: %v", reference.GuildID, err)})
+			}
+		case channelReference:
+			if missingGuilds[reference.GuildID] {
+				continue
+			}
+			channel, err := bot.State.Channel(discord.ChannelID(reference.ID))
+			if err != nil {
+				problems = append(problems, ConfigProblem{reference.Line, fmt.Sprintf("the bot can't see channel %s: %v", reference.ID, err)})
+			} else if channel.GuildID != reference.GuildID {
+				problems = append(problems, ConfigProblem{reference.Line, fmt.Sprintf("channel %s isn't in guild %s", reference.ID, reference.GuildID)})
+			}
+		case roleReference:
+			if missingGuilds[reference.GuildID] {
+				continue
+			}
+			if _, err := bot.State.Role(reference.GuildID, discord.RoleID(reference.ID)); err != nil {
+				problems = append(problems, ConfigProblem{reference.Line, fmt.Sprintf("there's no role %s in guild %s", reference.ID, reference.GuildID)})
+			}
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// configHistoryShown is how many changes /config history shows.
+const configHistoryShown = 15
+
+// configSettingChoices returns the choices for the option picking a setting.
+func configSettingChoices() []discord.StringChoice {
+	choices := make([]discord.StringChoice, len(configSettings))
+	for i, setting := range configSettings {
+		choices[i] = discord.StringChoice{Name: setting.Key, Value: setting.Key}
+	}
+	return choices
+}
+
+// isConfigSettingStored returns true if a setting has been changed from Discord for a guild.
+func isConfigSettingStored(setting ConfigSetting, guildID discord.GuildID) bool {
+	storedConfigMutex.Lock()
+	defer storedConfigMutex.Unlock()
+
+	_, stored := storedConfig.Settings[guildID][setting.Key]
+	return stored
+}
+
+// formatConfigSetting describes a setting's current value in a guild.
+func formatConfigSetting(setting ConfigSetting, guildID discord.GuildID) string {
+	value := setting.Get(currentConfig(), guildID)
+	if value == "" {
+		value = "*(empty)*"
+	}
+
+	source := "from config.yml"
+	if isConfigSettingStored(setting, guildID) {
+		source = "changed from Discord"
+	}
+
+	return fmt.Sprintf("**%s**: %s *(%s)*", setting.Key, value, source)
+}
+
+// OnConfigGetCommand is run by the interaction event dispatcher when the command to show
+// one of the guild's settings is activated.
+func (bot *Bot) OnConfigGetCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	setting := findConfigSetting(data.Options.Find("setting").String())
+	if setting == nil {
+		return bot.respondEphemerally(e, "There's no setting by that name.")
+	}
+
+	return bot.respondEphemerally(e, fmt.Sprintf("%s\n%s", formatConfigSetting(*setting, e.GuildID), setting.Description))
+}
+
+// OnConfigListCommand is run by the interaction event dispatcher when the command to list
+// all of the guild's settings is activated.
+func (bot *Bot) OnConfigListCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	lines := make([]string, len(configSettings))
+	for i, setting := range configSettings {
+		lines[i] = formatConfigSetting(setting, e.GuildID)
+	}
+
+	return bot.respondEphemerally(e, truncateMessage(strings.Join(lines, "\n")))
+}
+
+// OnConfigSetCommand is run by the interaction event dispatcher when the command to change
+// one of the guild's settings is activated. The new value is validated before it's stored,
+// and pickers are refreshed to match.
+func (bot *Bot) OnConfigSetCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	setting := findConfigSetting(data.Options.Find("setting").String())
+	if setting == nil {
+		return bot.respondEphemerally(e, "There's no setting by that name.")
+	}
+
+	oldValue := setting.Get(currentConfig(), e.GuildID)
+	value, err := bot.parseConfigValue(*setting, e.GuildID, data.Options.Find("value").String())
+	if err != nil {
+		return bot.respondEphemerally(e, fmt.Sprintf("That isn't a valid value for %s: %v", setting.Key, err))
+	}
+
+	if err := setConfigValues(e.GuildID, e.Member.User.ID, map[string]string{setting.Key: value}); errors.Is(err, errInconsistentSettings) || errors.Is(err, errInvalidSetting) {
+		return bot.respondEphemerally(e, truncateMessage(fmt.Sprintf("Couldn't change %s - %v", setting.Key, err)))
+	} else if err != nil {
+		return err
+	}
+	log.Println("Setting", setting.Key, "in guild", e.GuildID, "was changed by", e.Member.User.Tag(), "to", value)
+
+	if setting.Key == "verifiedRole" {
+		forgetVerifiedRole(e.GuildID)
+	}
+
+	if _, err := bot.RefreshPickers(e.GuildID); err != nil {
+		log.Println("Failed refreshing some pickers after changing", setting.Key, "with error", err)
+	}
+
+	return bot.respondEphemerally(e, truncateMessage(fmt.Sprintf("Changed **%s** ✨\nWas: %s\nNow: %s", setting.Key, oldValue, value)))
+}
+
+// OnConfigHistoryCommand is run by the interaction event dispatcher when the command to
+// show the recent changes to the guild's settings is activated.
+func (bot *Bot) OnConfigHistoryCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	changes := configHistory(e.GuildID)
+	if len(changes) == 0 {
+		return bot.respondEphemerally(e, "No settings have been changed from Discord yet.")
+	}
+
+	if len(changes) > configHistoryShown {
+		changes = changes[:configHistoryShown]
+	}
+
+	lines := make([]string, len(changes))
+	for i, change := range changes {
+		lines[i] = fmt.Sprintf("<t:%d:R> %s changed **%s** from %q to %q", change.ChangedAt.Unix(), change.ChangedBy.Mention(), change.Key, change.OldValue, change.NewValue)
+	}
+
+	return bot.respondEphemerally(e, truncateMessage(strings.Join(lines, "\n")))
+}
+
+// truncateMessage shortens a message to fit in Discord's message length limit.
+func truncateMessage(message string) string {
+	const maxMessageLength = 2000
+	runes := []rune(message)
+	if len(runes) <= maxMessageLength {
+		return message
+	}
+	return string(runes[:maxMessageLength-1]) + "…"
+}
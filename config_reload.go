@@ -0,0 +1,316 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"gopkg.in/yaml.v3"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 5 * time.Second
+
+// validateConfig checks that a config makes sense as a whole, so that a broken config
+// file is caught before it's used rather than when a member presses a button.
+func validateConfig(c Config) error {
+	if problems := configProblems(c); len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// configProblems returns what's wrong with a config as a whole, in order.
+func configProblems(c Config) []string {
+	problems := []string{}
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	if len(c.Pronouns) > maxPickerButtons {
+		addProblem("pronouns: there can be at most %d, but there are %d", maxPickerButtons, len(c.Pronouns))
+	}
+
+	for name, jobConfig := range c.Jobs {
+		if err := validateJobConfig(name, jobConfig); err != nil {
+			addProblem("jobs %s: %v", name, err)
+		}
+	}
+
+	for guildID, guildConfig := range c.Guilds {
+		if !guildID.IsValid() {
+			addProblem("guild %q isn't a valid ID", guildID)
+		}
+
+		for _, problem := range validateNameList(guildConfig.Colours) {
+			addProblem("guild %s colours: %s", guildID, problem)
+		}
+		for _, problem := range validateNameList(guildConfig.Pronouns) {
+			addProblem("guild %s pronouns: %s", guildID, problem)
+		}
+		if guildConfig.CustomColours && len(guildConfig.Colours) > maxCustomColourPickerButtons {
+			addProblem("guild %s colours: there can be at most %d when customColours is on, as its button takes a row, but there are %d",
+				guildID, maxCustomColourPickerButtons, len(guildConfig.Colours))
+		}
+
+		for channelID, channelConfig := range guildConfig.Channels {
+			for _, problem := range validateChannelConfig(channelConfig) {
+				addProblem("guild %s channel %s: %s", guildID, channelID, problem)
+			}
+		}
+		for categoryID, channelConfig := range guildConfig.Categories {
+			for _, problem := range validateChannelConfig(channelConfig) {
+				addProblem("guild %s category %s: %s", guildID, categoryID, problem)
+			}
+		}
+		if guildConfig.Reaper != nil {
+			for _, problem := range validateChannelConfig(*guildConfig.Reaper) {
+				addProblem("guild %s reaper: %s", guildID, problem)
+			}
+		}
+
+		for _, problem := range validateRoleConfigs(guildConfig.Roles) {
+			addProblem("guild %s roles: %s", guildID, problem)
+		}
+		for name, roles := range guildConfig.RoleGroups {
+			if name == "" {
+				addProblem("guild %s roleGroups: groups must have a name", guildID)
+			}
+			for _, problem := range validateRoleConfigs(roles) {
+				addProblem("guild %s roleGroups %s: %s", guildID, name, problem)
+			}
+		}
+
+		for capability, grant := range guildConfig.Permissions {
+			if _, known := capabilityDefaultPermissions[capability]; !known {
+				addProblem("guild %s permissions: unknown capability %q", guildID, capability)
+			}
+			for _, permission := range grant.Permissions {
+				if _, known := permissionNames[permission]; !known {
+					addProblem("guild %s permissions %s: unknown permission %q", guildID, capability, permission)
+				}
+			}
+		}
+	}
+
+	sort.Strings(problems)
+	return problems
+}
+
+// validateNameList checks a list of names for picker buttons, returning what's wrong with it.
+func validateNameList(names []string) []string {
+	problems := []string{}
+	if len(names) > maxPickerButtons {
+		problems = append(problems, fmt.Sprintf("there can be at most %d, but there are %d", maxPickerButtons, len(names)))
+	}
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			problems = append(problems, "names can't be empty")
+		}
+		if len(name) > maxButtonLabelLength {
+			problems = append(problems, fmt.Sprintf("%q is too long - names can be at most %d characters", name, maxButtonLabelLength))
+		}
+	}
+	return problems
+}
+
+// validateChannelConfig checks how a channel, or the channels in a category or guild, are
+// reaped, returning what's wrong with it.
+func validateChannelConfig(channelConfig ChannelConfig) []string {
+	problems := []string{}
+	if channelConfig.ReapDuration <= 0 {
+		problems = append(problems, "reapDuration must be more than zero")
+	}
+	if channelConfig.ArchiveRetention < 0 {
+		problems = append(problems, "archiveRetention can't be negative")
+	}
+	if channelConfig.StaleThreads != "" && channelConfig.StaleThreads != staleThreadsLock && channelConfig.StaleThreads != staleThreadsDelete {
+		problems = append(problems, fmt.Sprintf("staleThreads should be %q or %q, not %q", staleThreadsLock, staleThreadsDelete, channelConfig.StaleThreads))
+	}
+	return problems
+}
+
+// validateRoleConfigs checks a list of roles for a role picker, returning what's wrong with it.
+func validateRoleConfigs(roles []RoleConfig) []string {
+	problems := validateNameList(RoleNames(roles))
+
+	names := map[string]bool{}
+	for _, role := range roles {
+		if names[role.Name] {
+			problems = append(problems, fmt.Sprintf("%q is listed more than once", role.Name))
+		}
+		names[role.Name] = true
+
+		if role.StudentType != "" && GetStudentTypeFromName(role.StudentType) == nil {
+			problems = append(problems, fmt.Sprintf("%q has an unknown studentType %q", role.Name, role.StudentType))
+		}
+		if role.Duration < 0 {
+			problems = append(problems, fmt.Sprintf("%q has a negative duration", role.Name))
+		}
+		for _, conflict := range role.ConflictsWith {
+			if conflict == role.Name {
+				problems = append(problems, fmt.Sprintf("%q conflicts with itself", role.Name))
+			}
+		}
+	}
+	return problems
+}
+
+// ReloadConfig reads the config file again and starts using it, with the settings
+// changed from Discord applied on top. If the file can't be read or isn't valid,
+// the config in use is kept and the error is returned.
+func (bot *Bot) ReloadConfig() error {
+	newFileConfig, err := readConfigFile(configPath)
+	if err != nil {
+		return err
+	}
+
+	storedConfigMutex.Lock()
+	oldConfig := currentConfig()
+	fileConfig = newFileConfig
+	newConfig := applyStoredConfig(newFileConfig)
+	setCurrentConfig(newConfig)
+	storedConfigMutex.Unlock()
+
+	changes := describeConfigChanges(oldConfig, newConfig)
+	if len(changes) == 0 {
+		log.Println("Reloaded config, nothing changed")
+		return nil
+	}
+
+	log.Println("Reloaded config with", len(changes), "changes:")
+	for _, change := range changes {
+		log.Println("  " + change)
+	}
+
+	// the verified role may have changed, so look it up again next time it's needed
+	forgetVerifiedRole(discord.NullGuildID)
+
+	refreshed, err := bot.RefreshPickers(discord.NullGuildID)
+	if err != nil {
+		log.Println("Failed refreshing some picker messages after reloading config:", err)
+	}
+	log.Println("Refreshed", refreshed, "picker messages after reloading config")
+
+	return nil
+}
+
+// describeConfigChanges lists the differences between two configs, in a form that's
+// easy to read in the log.
+func describeConfigChanges(oldConfig, newConfig Config) []string {
+	changes := []string{}
+
+	if oldPronouns, newPronouns := strings.Join(oldConfig.Pronouns, ", "), strings.Join(newConfig.Pronouns, ", "); oldPronouns != newPronouns {
+		changes = append(changes, fmt.Sprintf("pronouns: %q -> %q", oldPronouns, newPronouns))
+	}
+
+	if !sameYAML(oldConfig.Jobs, newConfig.Jobs) {
+		changes = append(changes, "jobs: changed")
+	}
+
+	guildIDs := map[discord.GuildID]bool{}
+	for guildID := range oldConfig.Guilds {
+		guildIDs[guildID] = true
+	}
+	for guildID := range newConfig.Guilds {
+		guildIDs[guildID] = true
+	}
+
+	sortedGuildIDs := make([]discord.GuildID, 0, len(guildIDs))
+	for guildID := range guildIDs {
+		sortedGuildIDs = append(sortedGuildIDs, guildID)
+	}
+	sort.Slice(sortedGuildIDs, func(i, j int) bool { return sortedGuildIDs[i] < sortedGuildIDs[j] })
+
+	for _, guildID := range sortedGuildIDs {
+		oldGuild, inOld := oldConfig.Guilds[guildID]
+		newGuild, inNew := newConfig.Guilds[guildID]
+		switch {
+		case !inOld:
+			changes = append(changes, fmt.Sprintf("guild %s: added", guildID))
+			continue
+		case !inNew:
+			changes = append(changes, fmt.Sprintf("guild %s: removed", guildID))
+			continue
+		}
+
+		for _, setting := range configSettings {
+			oldValue, newValue := setting.Get(oldConfig, guildID), setting.Get(newConfig, guildID)
+			if oldValue != newValue {
+				changes = append(changes, fmt.Sprintf("guild %s %s: %q -> %q", guildID, setting.Key, oldValue, newValue))
+			}
+		}
+
+		// these can only be set in the config file, so aren't covered by the settings
+		if !sameYAML(oldGuild.Roles, newGuild.Roles) && strings.Join(RoleNames(oldGuild.Roles), ",") == strings.Join(RoleNames(newGuild.Roles), ",") {
+			changes = append(changes, fmt.Sprintf("guild %s roles: prerequisites changed", guildID))
+		}
+		if !sameYAML(oldGuild.Channels, newGuild.Channels) && findConfigSetting("channels").Get(oldConfig, guildID) == findConfigSetting("channels").Get(newConfig, guildID) {
+			changes = append(changes, fmt.Sprintf("guild %s channels: archiving, keep rules or stale threads changed", guildID))
+		}
+		if !sameYAML(oldGuild.Categories, newGuild.Categories) || !sameYAML(oldGuild.Reaper, newGuild.Reaper) || !sameYAML(oldGuild.ExcludeChannels, newGuild.ExcludeChannels) {
+			changes = append(changes, fmt.Sprintf("guild %s reaper defaults: changed", guildID))
+		}
+		if !sameYAML(oldGuild.RoleGroups, newGuild.RoleGroups) {
+			changes = append(changes, fmt.Sprintf("guild %s roleGroups: changed", guildID))
+		}
+		if !sameYAML(oldGuild.Permissions, newGuild.Permissions) {
+			changes = append(changes, fmt.Sprintf("guild %s permissions: changed", guildID))
+		}
+	}
+
+	return changes
+}
+
+// sameYAML checks whether two values are the same once written out as YAML.
+func sameYAML(a, b interface{}) bool {
+	aYAML, aErr := yaml.Marshal(a)
+	bYAML, bErr := yaml.Marshal(b)
+	return aErr == nil && bErr == nil && string(aYAML) == string(bYAML)
+}
+
+// WatchConfig reloads the config whenever the bot is sent SIGHUP, or the config file
+// changes. It never returns, so should be run in its own goroutine.
+func (bot *Bot) WatchConfig() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	lastModified := configModTime()
+
+	for {
+		select {
+		case <-hangups:
+			log.Println("Got SIGHUP, reloading config")
+		case <-ticker.C:
+			modified := configModTime()
+			if modified.Equal(lastModified) {
+				continue
+			}
+			lastModified = modified
+			log.Println("Config file changed, reloading config")
+		}
+
+		if err := bot.ReloadConfig(); err != nil {
+			log.Println("Failed reloading config, keeping the old one:", err)
+		}
+	}
+}
+
+// configModTime returns when the config file was last changed, or the zero time if it can't be found.
+func configModTime() time.Time {
+	info, err := os.Stat(configPath)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{value: "12h", want: 12 * time.Hour},
+		{value: "90m", want: 90 * time.Minute},
+		{value: "7d", want: 7 * 24 * time.Hour},
+		{value: "2w", want: 14 * 24 * time.Hour},
+		{value: "1w2d12h", want: 9*24*time.Hour + 12*time.Hour},
+		{value: "1.5d", want: 36 * time.Hour},
+		{value: "0", want: 0},
+		{value: "-1d", want: -24 * time.Hour},
+		{value: "", wantErr: true},
+		{value: "7", wantErr: true},
+		{value: "a week", wantErr: true},
+		{value: "7days", wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseDuration(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseDuration(%q) = %v, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseDuration(%q) failed with error %v", test.value, err)
+			}
+			if got != test.want {
+				t.Errorf("parseDuration(%q) = %v, want %v", test.value, got, test.want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalConfigForms(t *testing.T) {
+	want := Config{Guilds: GuildConfigs{
+		1: {
+			Channels:   ChannelConfigs{10: {ReapDuration: Duration(7 * 24 * time.Hour)}},
+			Categories: CategoryConfigs{20: {ReapDuration: Duration(2 * time.Hour)}},
+			Roles:      []RoleConfig{{Name: "gaming"}, {Name: "film", RequiresVerified: true}},
+		},
+	}}
+
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{
+			name: "mappings",
+			yaml: `
+guilds:
+  1:
+    channels:
+      10: {reapDuration: 7d}
+    categories:
+      20: {reapDuration: 2h}
+    roles:
+      - name: gaming
+      - {name: film, requiresVerified: true}
+`,
+		},
+		{
+			name: "lists",
+			yaml: `
+guilds:
+  - guildID: 1
+    channels:
+      - {channelID: 10, reapDuration: 1w}
+    categories:
+      - {categoryID: 20, reapDuration: 120m}
+    roles:
+      - gaming
+      - {name: film, requiresVerified: yes}
+`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var got Config
+			if err := yaml.Unmarshal([]byte(test.yaml), &got); err != nil {
+				t.Fatalf("Unmarshal failed with error %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestUnmarshalConfigListWithoutID(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want string
+	}{
+		{"guild", "guilds:\n  - alumniGuild: true\n", "line 2: every guild in the list of guilds needs a guildID"},
+		{"channel", "guilds:\n  1:\n    channels:\n      - reapDuration: 1d\n", "line 4: every channel in the list of channels needs a channelID"},
+		{"category", "guilds:\n  1:\n    categories:\n      - reapDuration: 1d\n", "line 4: every category in the list of categories needs a categoryID"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c Config
+			err := yaml.Unmarshal([]byte(test.yaml), &c)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("Unmarshal returned error %v, want one containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfigFile(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []ConfigProblem
+	}{
+		{
+			name: "valid",
+			yaml: "guilds:\n  1:\n    alumniGuild: yes\n    channels:\n      10: {reapDuration: 7d}\n",
+			want: []ConfigProblem{},
+		},
+		{
+			name: "empty",
+			yaml: "",
+			want: []ConfigProblem{{Message: "the file is empty"}},
+		},
+		{
+			name: "syntax error",
+			yaml: "guilds:\n  1:\n\tcolours: [red]\n",
+			want: []ConfigProblem{{Line: 3, Message: "found character that cannot start any token"}},
+		},
+		{
+			name: "unknown keys",
+			yaml: "guilds:\n  1:\n    colors: [red]\n    channels:\n      - channelID: 10\n        reapDuration: 1d\n        archve: true\n",
+			want: []ConfigProblem{{Line: 3, Message: `unknown key "colors"`}, {Line: 7, Message: `unknown key "archve"`}},
+		},
+		{
+			name: "bad values",
+			yaml: "guilds:\n  1:\n    customColours: maybe\n    reaper:\n      reapDuration: a week\n",
+			want: []ConfigProblem{
+				{Line: 3, Message: "cannot unmarshal !!str `maybe` into bool"},
+				{Line: 5, Message: `"a week" isn't a valid duration - try something like 12h, 7d or 2w`},
+			},
+		},
+		{
+			name: "invalid config",
+			yaml: "guilds:\n  1:\n    channels:\n      10: {staleThreads: lock}\n",
+			want: []ConfigProblem{{Message: "guild 1 channel 10: reapDuration must be more than zero"}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yml")
+			if err := ioutil.WriteFile(path, []byte(test.yaml), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			problems, _, err := checkConfigFile(path)
+			if err != nil {
+				t.Fatalf("checkConfigFile failed with error %v", err)
+			}
+			if !reflect.DeepEqual(problems, test.want) {
+				t.Errorf("checkConfigFile = %+v, want %+v", problems, test.want)
+			}
+		})
+	}
+}
+
+func TestCheckConfigFileReferences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	contents := "guilds:\n  1:\n    verifiedRole: 100\n    channels:\n      10:\n        reapDuration: 1d\n        keep: {roles: [101]}\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, references, err := checkConfigFile(path)
+	if err != nil {
+		t.Fatalf("checkConfigFile failed with error %v", err)
+	}
+	want := []configReference{
+		{2, guildReference, 1, 1},
+		{3, roleReference, 1, 100},
+		{5, channelReference, 1, 10},
+		{7, roleReference, 1, 101},
+	}
+	if !reflect.DeepEqual(references, want) {
+		t.Errorf("checkConfigFile references = %+v, want %+v", references, want)
+	}
+}
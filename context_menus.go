@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// contextMenuTargetUser returns the user a user context menu command was run on.
+func contextMenuTargetUser(data *discord.CommandInteraction) (discord.User, error) {
+	user, ok := data.Resolved.Users[data.TargetUserID()]
+	if !ok {
+		return discord.User{}, fmt.Errorf("user %s targeted by %s wasn't resolved", data.TargetUserID(), data.Name)
+	}
+	return user, nil
+}
+
+// OnVerificationStatusCommand is run by the interaction event dispatcher when the context
+// menu command to check a member's verification status is used on them.
+func (bot *Bot) OnVerificationStatusCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	user, err := contextMenuTargetUser(data)
+	if err != nil {
+		return err
+	}
+
+	memberType := getMemberTypeForGuild(e.GuildID)
+	authenticated, code := isDiscordAuthenticated(user, memberType)
+
+	var message string
+	switch {
+	case authenticated:
+		message = fmt.Sprintf("✅ %s is authenticated as %s.", user.Mention(), aOrAn(memberType.Name()))
+	case code == "":
+		message = fmt.Sprintf("❌ %s hasn't authenticated at all.", user.Mention())
+	case GetStudentTypeFromCode(code) != nil:
+		message = fmt.Sprintf("⚠️ %s is authenticated as %s, but this server needs them to be %s.", user.Mention(), aOrAn(GetStudentTypeFromCode(code).Name()), aOrAn(memberType.Name()))
+	default:
+		message = fmt.Sprintf("⚠️ %s is authenticated with an unknown member type, %q.", user.Mention(), code)
+	}
+
+	verifiedRole, err := bot.getVerifiedRole(e.GuildID)
+	if err != nil {
+		return err
+	}
+
+	if member, ok := data.Resolved.Members[user.ID]; ok {
+		if memberHasRole(&member, *verifiedRole) {
+			message += " They have the verified role."
+		} else {
+			message += " They don't have the verified role."
+		}
+	} else {
+		message += " They aren't in the server."
+	}
+
+	return bot.respondEphemerally(e, message)
+}
+
+// OnResendVerificationCommand is run by the interaction event dispatcher when the context
+// menu command to send a member the verification DM again is used on them.
+func (bot *Bot) OnResendVerificationCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	user, err := contextMenuTargetUser(data)
+	if err != nil {
+		return err
+	}
+
+	if user.Bot {
+		return bot.respondEphemerally(e, "Bots can't verify themselves, silly 🤖")
+	}
+
+	// VerifyUser waits around for the member to verify, so it can't hold up the interaction
+	go func() {
+		if err := bot.VerifyUser(user, e.GuildID); err != nil {
+			log.Println("Failed re-sending verification to user", user.Username, "with error", err)
+		}
+	}()
+
+	return bot.respondEphemerally(e, fmt.Sprintf("Sent %s the verification DM again 📨", user.Mention()))
+}
+
+// OnManuallyVerifyCommand is run by the interaction event dispatcher when the context
+// menu command to verify a member by hand is used on them.
+func (bot *Bot) OnManuallyVerifyCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	user, err := contextMenuTargetUser(data)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := data.Resolved.Members[user.ID]; !ok {
+		return bot.respondEphemerally(e, fmt.Sprintf("%s isn't in the server any more.", user.Mention()))
+	}
+
+	verifiedRole, err := bot.getVerifiedRole(e.GuildID)
+	if err != nil {
+		return err
+	}
+
+	err = bot.State.AddRole(e.GuildID, user.ID, *verifiedRole, api.AddRoleData{
+		AuditLogReason: api.AuditLogReason(fmt.Sprintf("Manually verified by %s", e.Member.User.Tag())),
+	})
+	if err != nil {
+		return err
+	}
+
+	return bot.respondEphemerally(e, fmt.Sprintf("%s is now verified ✅", user.Mention()))
+}
+
+// OnReportMessageCommand is run by the interaction event dispatcher when the context menu
+// command to report a message is used on it. The report is posted to the guild's report
+// channel for committee to look at.
+func (bot *Bot) OnReportMessageCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	reportChannel := currentConfig().Guilds[e.GuildID].ReportChannel
+	if !reportChannel.IsValid() {
+		return bot.respondEphemerally(e, "Sorry, reporting messages isn't set up on this server - please message a committee member instead.")
+	}
+
+	message, ok := data.Resolved.Messages[data.TargetMessageID()]
+	if !ok {
+		return fmt.Errorf("message %s targeted by %s wasn't resolved", data.TargetMessageID(), data.Name)
+	}
+	// resolved messages don't always say which guild they're in, which their URL needs
+	message.GuildID = e.GuildID
+
+	content := message.Content
+	if content == "" {
+		content = "*(no text)*"
+	}
+
+	_, err := bot.State.SendMessageComplex(reportChannel, api.SendMessageData{
+		Content: fmt.Sprintf("🚩 %s reported a message in %s", e.Member.User.Mention(), message.ChannelID.Mention()),
+		Embeds: []discord.Embed{
+			{
+				Author: &discord.EmbedAuthor{
+					Name: message.Author.Tag(),
+					Icon: message.Author.AvatarURL(),
+				},
+				Description: content,
+				URL:         message.URL(),
+				Title:       "Jump to message",
+				Timestamp:   message.Timestamp,
+				Footer: &discord.EmbedFooter{
+					Text: fmt.Sprintf("Author ID %s", message.Author.ID),
+				},
+			},
+		},
+		AllowedMentions: &api.AllowedMentions{},
+	})
+	if err != nil {
+		return err
+	}
+
+	return bot.respondEphemerally(e, "Thanks for letting us know - committee have been sent your report 💜")
+}
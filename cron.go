@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronDescriptors are the shorthands that can be used instead of a full cron expression.
+var cronDescriptors = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+// cronSchedule is a parsed cron expression - minute, hour, day of month, month and day
+// of week - with a bit set for each value each field matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// anyDay and anyWeekday are set when the day of month or week is *, as when both are
+	// restricted, a day matches if either of them does.
+	anyDay, anyWeekday bool
+}
+
+// cronField describes the values a field of a cron expression can take.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+var cronFields = []cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCron parses a cron expression with five fields, each of which can be *, a value,
+// a range like 1-5, a list like 1,3,5, or any of those with a step like */15.
+func parseCron(expression string) (*cronSchedule, error) {
+	if descriptor, ok := cronDescriptors[strings.TrimSpace(expression)]; ok {
+		expression = descriptor
+	}
+
+	parts := strings.Fields(expression)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("%q should have %d fields - minute, hour, day of month, month and day of week", expression, len(cronFields))
+	}
+
+	bits := make([]uint64, len(cronFields))
+	for i, part := range parts {
+		var err error
+		bits[i], err = parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sunday can be given as either 0 or 7
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &cronSchedule{
+		minutes:    bits[0],
+		hours:      bits[1],
+		days:       bits[2],
+		months:     bits[3],
+		weekdays:   bits[4],
+		anyDay:     parts[2] == "*",
+		anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+// parseCronField parses one field of a cron expression into a bit set of the values it matches.
+func parseCronField(part string, field cronField) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rangePart, step := item, 1
+		if i := strings.Index(item, "/"); i >= 0 {
+			var err error
+			rangePart = item[:i]
+			step, err = strconv.Atoi(item[i+1:])
+			if err != nil || step <= 0 {
+				return 0, fmt.Errorf("%q isn't a valid step for the %s", item[i+1:], field.name)
+			}
+		}
+
+		low, high := field.min, field.max
+		if rangePart != "*" {
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			low, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("%q isn't a valid %s", bounds[0], field.name)
+			}
+			high = low
+			if len(bounds) == 2 {
+				high, err = strconv.Atoi(bounds[1])
+				if err != nil {
+					return 0, fmt.Errorf("%q isn't a valid %s", bounds[1], field.name)
+				}
+			} else if step > 1 {
+				// like 5/15, meaning from 5 onwards
+				high = field.max
+			}
+		}
+
+		if low < field.min || high > field.max || low > high {
+			return 0, fmt.Errorf("%q is out of range for the %s, which goes from %d to %d", item, field.name, field.min, field.max)
+		}
+
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the first time after the one given that the schedule matches.
+func (c *cronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// five years is enough to find any date that exists, like the 29th of February
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case c.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay checks whether the schedule runs on the day of the time given.
+func (c *cronSchedule) matchesDay(t time.Time) bool {
+	dayMatches := c.days&(1<<uint(t.Day())) != 0
+	weekdayMatches := c.weekdays&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.anyDay && c.anyWeekday:
+		return true
+	case c.anyDay:
+		return weekdayMatches
+	case c.anyWeekday:
+		return dayMatches
+	default:
+		return dayMatches || weekdayMatches
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronRejects(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+		"@yearly",
+	}
+
+	for _, expression := range tests {
+		t.Run(expression, func(t *testing.T) {
+			if _, err := parseCron(expression); err == nil {
+				t.Errorf("parseCron(%q) succeeded, want an error", expression)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// a Wednesday
+	after := time.Date(2024, time.January, 10, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		want       time.Time
+	}{
+		{"every minute", "* * * * *", time.Date(2024, time.January, 10, 12, 31, 0, 0, time.UTC)},
+		{"every 15 minutes", "*/15 * * * *", time.Date(2024, time.January, 10, 12, 45, 0, 0, time.UTC)},
+		{"step from a value", "10/20 * * * *", time.Date(2024, time.January, 10, 12, 50, 0, 0, time.UTC)},
+		{"later today", "0 18 * * *", time.Date(2024, time.January, 10, 18, 0, 0, 0, time.UTC)},
+		{"tomorrow", "0 3 * * *", time.Date(2024, time.January, 11, 3, 0, 0, 0, time.UTC)},
+		{"list", "0 1,13 * * *", time.Date(2024, time.January, 10, 13, 0, 0, 0, time.UTC)},
+		{"range of weekdays", "0 9 * * 1-5", time.Date(2024, time.January, 11, 9, 0, 0, 0, time.UTC)},
+		{"Sunday as 0", "0 0 * * 0", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"Sunday as 7", "0 0 * * 7", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"Saturday to Sunday as 6-7", "0 0 * * 6-7", time.Date(2024, time.January, 13, 0, 0, 0, 0, time.UTC)},
+		{"day of month", "0 0 1 * *", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		// when both the day of month and week are restricted, either matching is enough
+		{"day of month or week, week first", "0 0 20 * 5", time.Date(2024, time.January, 12, 0, 0, 0, 0, time.UTC)},
+		{"day of month or week, month first", "0 0 11 * 0", time.Date(2024, time.January, 11, 0, 0, 0, 0, time.UTC)},
+		{"month", "0 0 1 3 *", time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)},
+		{"leap day", "0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"descriptor", "@weekly", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)},
+		{"never", "0 0 31 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := parseCron(test.expression)
+			if err != nil {
+				t.Fatalf("parseCron(%q) failed with error %v", test.expression, err)
+			}
+			if got := schedule.Next(after); !got.Equal(test.want) {
+				t.Errorf("parseCron(%q).Next(%v) = %v, want %v", test.expression, after, got, test.want)
+			}
+		})
+	}
+}
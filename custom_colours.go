@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// customColourRolesFile is the data file that members' personal colour roles are kept in.
+const customColourRolesFile = "custom_colours.json"
+
+// custom_colour_input_id is the ID of the text input for the hex code in the custom colour modal.
+const custom_colour_input_id = "custom_colour_hex"
+
+// minimumColourContrast is the lowest contrast ratio a custom colour can have against
+// either of Discord's themes, so that usernames stay readable for everyone.
+const minimumColourContrast = 2.0
+
+// minimumModeratorColourDistance is how far away (in perceptual RGB distance) a custom colour
+// has to be from moderators' role colours, so that nobody can pass themselves off as one.
+const minimumModeratorColourDistance = 80.0
+
+// discordThemeBackgrounds are the background colours of Discord's dark and light themes.
+var discordThemeBackgrounds = []discord.Color{0x313338, 0xFFFFFF}
+
+// moderatorPermissions are the permissions that mark a role as belonging to moderators.
+const moderatorPermissions = discord.PermissionAdministrator | discord.PermissionManageGuild | discord.PermissionManageRoles |
+	discord.PermissionKickMembers | discord.PermissionBanMembers | discord.PermissionModerateMembers
+
+// hexColourPattern matches a six digit hex colour, with or without a leading #.
+var hexColourPattern = regexp.MustCompile(`^#?([0-9a-fA-F]{6})$`)
+
+// customColourRoles maps guild IDs to members to the ID of their personal colour role, guarded by customColourRolesMutex.
+var customColourRoles = map[discord.GuildID]map[discord.UserID]discord.RoleID{}
+var customColourRolesMutex sync.Mutex
+
+// loadCustomColourRoles reads members' personal colour roles in from the data directory.
+func loadCustomColourRoles() error {
+	customColourRolesMutex.Lock()
+	defer customColourRolesMutex.Unlock()
+
+	return loadJSON(customColourRolesFile, &customColourRoles)
+}
+
+// customColourButtonRow returns the action row holding the custom colour button for colour pickers.
+func customColourButtonRow() *discord.ActionRowComponent {
+	return &discord.ActionRowComponent{
+		&discord.ButtonComponent{
+			CustomID: CustomID{Type: CustomColourButtonID}.Encode(),
+			Label:    "Something else...",
+			Emoji: &discord.ComponentEmoji{
+				Name: "🖌️",
+			},
+			Style: discord.PrimaryButtonStyle(),
+		},
+	}
+}
+
+// OnCustomColourButton is run by the interaction event dispatcher when the custom colour
+// button on a colour picker is pressed. It asks the member for a hex code with a modal.
+func (bot *Bot) OnCustomColourButton(e *gateway.InteractionCreateEvent) error {
+	if !currentConfig().Guilds[e.GuildID].CustomColours {
+		return bot.respondEphemerally(e, "Sorry, custom colours aren't available on this server any more 😢")
+	}
+
+	return bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.ModalResponse,
+		Data: &api.InteractionResponseData{
+			CustomID: option.NewNullableString(string(CustomID{Type: CustomColourModalID}.Encode())),
+			Title:    option.NewNullableString("Pick your own colour"),
+			Components: discord.ComponentsPtr(
+				&discord.ActionRowComponent{
+					&discord.TextInputComponent{
+						CustomID:     custom_colour_input_id,
+						Style:        discord.TextInputShortStyle,
+						Label:        "Hex code",
+						LengthLimits: [2]int{6, 7},
+						Required:     true,
+						Placeholder:  option.NewNullableString("#FF69B4"),
+					},
+				},
+			),
+		},
+	})
+}
+
+// OnCustomColourModal is run by the interaction event dispatcher when the custom colour
+// modal is submitted. It validates the colour, then gives the member a personal role in it.
+func (bot *Bot) OnCustomColourModal(e *gateway.InteractionCreateEvent, data *discord.ModalInteraction) error {
+	if e.Member == nil || !currentConfig().Guilds[e.GuildID].CustomColours {
+		return bot.respondEphemerally(e, "Sorry, custom colours aren't available here 😢")
+	}
+
+	colour, problem, err := bot.validateCustomColour(e.GuildID, modalTextValue(data, custom_colour_input_id))
+	if err != nil {
+		return err
+	}
+
+	if problem != "" {
+		return bot.respondEphemerally(e, problem)
+	}
+
+	if err := bot.setCustomColourRole(e.GuildID, e.Member, colour); err != nil {
+		return err
+	}
+
+	return bot.respondEphemerally(e, fmt.Sprintf("Looking good! Your username is now %s 🎨", colour))
+}
+
+// modalTextValue finds the value submitted for a text input in a modal.
+func modalTextValue(data *discord.ModalInteraction, inputID discord.ComponentID) string {
+	for _, container := range data.Components {
+		row, ok := container.(*discord.ActionRowComponent)
+		if !ok {
+			continue
+		}
+
+		for _, component := range *row {
+			if input, ok := component.(*discord.TextInputComponent); ok && input.CustomID == inputID && input.Value != nil {
+				return input.Value.Val
+			}
+		}
+	}
+
+	return ""
+}
+
+// validateCustomColour parses a hex colour, and checks that it's readable on both of
+// Discord's themes and can't be confused with a moderator's colour. It returns the
+// colour, or a message for the member explaining what's wrong with it.
+func (bot *Bot) validateCustomColour(guildID discord.GuildID, hex string) (discord.Color, string, error) {
+	match := hexColourPattern.FindStringSubmatch(strings.TrimSpace(hex))
+	if match == nil {
+		return 0, "That doesn't look like a hex colour - it should be six digits and letters from A to F, like #FF69B4.", nil
+	}
+
+	parsed, err := strconv.ParseUint(match[1], 16, 32)
+	if err != nil {
+		return 0, "", err
+	}
+	colour := discord.Color(parsed)
+
+	for _, background := range discordThemeBackgrounds {
+		if contrastRatio(colour, background) < minimumColourContrast {
+			return 0, fmt.Sprintf("%s is a bit hard to read on Discord's light or dark theme - try something a little brighter or darker.", colour), nil
+		}
+	}
+
+	roles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	for _, role := range roles {
+		if role.Color == 0 || role.Permissions&moderatorPermissions == 0 {
+			continue
+		}
+
+		if colourDistance(colour, role.Color) < minimumModeratorColourDistance {
+			return 0, fmt.Sprintf("%s is too close to the colour used by %s - please pick something else.", colour, role.Name), nil
+		}
+	}
+
+	return colour, "", nil
+}
+
+// setCustomColourRole gives a member their personal colour role in the given colour,
+// creating it if they don't have one yet, and takes away any colours from the picker.
+func (bot *Bot) setCustomColourRole(guildID discord.GuildID, member *discord.Member, colour discord.Color) error {
+	customColourRolesMutex.Lock()
+	defer customColourRolesMutex.Unlock()
+
+	auditLogReason := api.AuditLogReason(fmt.Sprintf("%s requested custom colour %s", member.User.Username, colour))
+
+	roleID, exists := customColourRoles[guildID][member.User.ID]
+	if exists {
+		_, err := bot.State.ModifyRole(guildID, roleID, api.ModifyRoleData{
+			Color:       colour,
+			AddRoleData: api.AddRoleData{AuditLogReason: auditLogReason},
+		})
+		if isNotFound(err) {
+			// someone's deleted the role from under us - make a new one
+			exists = false
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if !exists {
+		role, err := bot.State.CreateRole(guildID, api.CreateRoleData{
+			Name:        fmt.Sprintf("%s's colour", member.User.Username),
+			Color:       colour,
+			AddRoleData: api.AddRoleData{AuditLogReason: auditLogReason},
+		})
+		if err != nil {
+			return err
+		}
+		recordCreatedRole(guildID, role)
+		roleID = role.ID
+
+		if customColourRoles[guildID] == nil {
+			customColourRoles[guildID] = map[discord.UserID]discord.RoleID{}
+		}
+		customColourRoles[guildID][member.User.ID] = roleID
+
+		if err := saveJSON(customColourRolesFile, customColourRoles); err != nil {
+			return err
+		}
+	}
+
+	if err := bot.State.AddRole(guildID, member.User.ID, roleID, api.AddRoleData{AuditLogReason: auditLogReason}); err != nil {
+		return err
+	}
+
+	// only one colour can show at once, so drop any they've picked from the picker
+	for _, colourName := range currentConfig().Guilds[guildID].Colours {
+		role, err := bot.findRoleByName(guildID, colourName)
+		if err != nil {
+			return err
+		}
+
+		if role != nil && memberHasRole(member, role.ID) {
+			if err := bot.State.RemoveRole(guildID, member.User.ID, role.ID, "Picked a custom colour instead"); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// removeCustomColourRole deletes a member's personal colour role, if they have one.
+func (bot *Bot) removeCustomColourRole(guildID discord.GuildID, userID discord.UserID, auditLogReason string) error {
+	customColourRolesMutex.Lock()
+	defer customColourRolesMutex.Unlock()
+
+	roleID, exists := customColourRoles[guildID][userID]
+	if !exists {
+		return nil
+	}
+
+	if err := bot.State.DeleteRole(guildID, roleID, api.AuditLogReason(auditLogReason)); err != nil && !isNotFound(err) {
+		return err
+	}
+
+	delete(customColourRoles[guildID], userID)
+	return saveJSON(customColourRolesFile, customColourRoles)
+}
+
+// relativeLuminance calculates the relative luminance of a colour, as defined by WCAG 2.
+func relativeLuminance(colour discord.Color) float64 {
+	r, g, b := colour.RGB()
+
+	linear := func(channel uint8) float64 {
+		c := float64(channel) / 255
+		if c <= 0.03928 {
+			return c / 12.92
+		}
+		return math.Pow((c+0.055)/1.055, 2.4)
+	}
+
+	return 0.2126*linear(r) + 0.7152*linear(g) + 0.0722*linear(b)
+}
+
+// contrastRatio calculates the WCAG 2 contrast ratio between two colours, from 1 to 21.
+func contrastRatio(a, b discord.Color) float64 {
+	lighter, darker := relativeLuminance(a), relativeLuminance(b)
+	if darker > lighter {
+		lighter, darker = darker, lighter
+	}
+
+	return (lighter + 0.05) / (darker + 0.05)
+}
+
+// colourDistance approximates how different two colours look, using the "redmean"
+// weighted Euclidean distance - cheap, but much closer to perception than plain RGB.
+func colourDistance(a, b discord.Color) float64 {
+	ar, ag, ab := a.RGB()
+	br, bg, bb := b.RGB()
+
+	redMean := (float64(ar) + float64(br)) / 2
+	dr, dg, db := float64(ar)-float64(br), float64(ag)-float64(bg), float64(ab)-float64(bb)
+
+	return math.Sqrt((2+redMean/256)*dr*dr + 4*dg*dg + (2+(255-redMean)/256)*db*db)
+}
+
+// OnGuildMemberRemove cleans up after a member who has left a guild.
+func (bot *Bot) OnGuildMemberRemove(guildID discord.GuildID, user discord.User) error {
+	return bot.removeCustomColourRole(guildID, user.ID, "Member left the server")
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// customIDVersion tags the custom IDs made by CustomID.Encode, so the format can change
+// later without breaking components that have already been posted.
+const customIDVersion = "v1"
+
+// customIDSeparator separates the parts of a custom ID.
+const customIDSeparator = ":"
+
+// customIDSignatureLength is how many bytes of the HMAC are kept in a signed custom ID.
+// Custom IDs can only be 100 characters long, so the full hash won't fit.
+const customIDSignatureLength = 12
+
+// CustomIDType identifies what a component is for, and so what its custom ID holds.
+type CustomIDType string
+
+const (
+	// PickerButtonID is a button on a picker that toggles a role. It holds the picker kind and role ID.
+	PickerButtonID CustomIDType = "pick"
+	// PickerRoleNameButtonID is a button on a picker for a role that hasn't been created yet,
+	// which is created when it's first picked. It holds the picker kind and role name.
+	PickerRoleNameButtonID CustomIDType = "pickname"
+	// VerifyButtonID is the button that starts verification in the guild it's in.
+	VerifyButtonID CustomIDType = "verify"
+	// VerifyInGuildButtonID is a button in DMs that starts verification for a guild. It holds the guild ID, and is signed.
+	VerifyInGuildButtonID CustomIDType = "verifyin"
+	// VerifiedButtonID is the button in DMs that a member presses once they've verified.
+	VerifiedButtonID CustomIDType = "verified"
+	// CustomColourButtonID is the colour picker button for typing in a custom colour.
+	CustomColourButtonID CustomIDType = "colour"
+	// CustomColourModalID is the modal that a custom colour is typed into.
+	CustomColourModalID CustomIDType = "colourmodal"
+	// GarbageRolesConfirmID is the button that confirms deleting empty roles.
+	GarbageRolesConfirmID CustomIDType = "gcconfirm"
+	// SetupSelectID is a select menu in the setup wizard. It holds the step it's for.
+	SetupSelectID CustomIDType = "setup"
+	// SetupButtonID is a button in the setup wizard. It holds the step it goes to, or the action it takes.
+	SetupButtonID CustomIDType = "setupnav"
+)
+
+// signedCustomIDTypes are the custom ID types that are signed, because they're posted
+// in DMs, where the guild they act on can't be checked against where they were pressed.
+var signedCustomIDTypes = map[CustomIDType]bool{
+	VerifyInGuildButtonID: true,
+}
+
+// legacyCustomIDPrefixes maps the prefixes used by custom IDs from before they were
+// versioned to the kinds of picker they belonged to. The prefixes were followed by a role name.
+var legacyCustomIDPrefixes = map[string]PickerKind{
+	"colour_button_":  ColourPicker,
+	"pronoun_button_": PronounPicker,
+	"role_button_":    RolePicker,
+}
+
+// legacyCustomIDs maps the fixed custom IDs from before they were versioned to their types.
+var legacyCustomIDs = map[string]CustomIDType{
+	"verifyme_button":      VerifyButtonID,
+	"verified_button":      VerifiedButtonID,
+	"custom_colour_button": CustomColourButtonID,
+	"custom_colour_modal":  CustomColourModalID,
+	"gc_roles_confirm":     GarbageRolesConfirmID,
+}
+
+// ErrUnknownCustomID is returned when a custom ID can't be decoded - it's from a
+// version of the bot we don't understand, or it's been tampered with.
+var ErrUnknownCustomID = errors.New("unknown custom ID")
+
+// CustomID is the decoded form of a component's custom ID.
+type CustomID struct {
+	Type    CustomIDType
+	Picker  PickerKind
+	RoleID  discord.RoleID
+	GuildID discord.GuildID
+
+	// Step is the setup wizard step or action a setup component is for.
+	Step string
+
+	// RoleName is set for picker buttons for roles that haven't been created yet, and legacy
+	// picker buttons, which held role names rather than IDs.
+	RoleName string
+}
+
+// Encode turns a CustomID into a component custom ID, signing it if its type needs it
+// and $CUSTOM_ID_SECRET is set.
+func (id CustomID) Encode() discord.ComponentID {
+	parts := []string{customIDVersion, string(id.Type)}
+
+	switch id.Type {
+	case PickerButtonID:
+		parts = append(parts, string(id.Picker), id.RoleID.String())
+	case PickerRoleNameButtonID:
+		parts = append(parts, string(id.Picker), id.RoleName)
+	case VerifyInGuildButtonID:
+		parts = append(parts, id.GuildID.String())
+	case SetupSelectID, SetupButtonID:
+		parts = append(parts, id.Step)
+	}
+
+	encoded := strings.Join(parts, customIDSeparator)
+	if signedCustomIDTypes[id.Type] {
+		if signature := signCustomID(encoded); signature != "" {
+			encoded += customIDSeparator + signature
+		}
+	}
+
+	return discord.ComponentID(encoded)
+}
+
+// DecodeCustomID decodes a component custom ID, including legacy ones from before
+// custom IDs were versioned. It returns ErrUnknownCustomID if it can't be decoded.
+func DecodeCustomID(raw discord.ComponentID) (CustomID, error) {
+	s := string(raw)
+	if !strings.HasPrefix(s, customIDVersion+customIDSeparator) {
+		return decodeLegacyCustomID(s)
+	}
+
+	parts := strings.Split(s, customIDSeparator)
+	id := CustomID{Type: CustomIDType(parts[1])}
+	payload := parts[2:]
+
+	if signedCustomIDTypes[id.Type] && customIDSecret() != "" {
+		if len(payload) == 0 {
+			return CustomID{}, fmt.Errorf("%w: %s is missing its signature", ErrUnknownCustomID, s)
+		}
+
+		unsigned := strings.Join(parts[:len(parts)-1], customIDSeparator)
+		if !hmac.Equal([]byte(signCustomID(unsigned)), []byte(payload[len(payload)-1])) {
+			return CustomID{}, fmt.Errorf("%w: %s has an invalid signature", ErrUnknownCustomID, s)
+		}
+		payload = payload[:len(payload)-1]
+	}
+
+	switch id.Type {
+	case PickerButtonID:
+		if len(payload) != 2 {
+			return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+		}
+
+		roleSnowflake, err := discord.ParseSnowflake(payload[1])
+		if err != nil {
+			return CustomID{}, fmt.Errorf("%w: %s has an invalid role ID: %v", ErrUnknownCustomID, s, err)
+		}
+
+		id.Picker = PickerKind(payload[0])
+		id.RoleID = discord.RoleID(roleSnowflake)
+	case PickerRoleNameButtonID:
+		if len(payload) < 2 {
+			return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+		}
+
+		// role names can contain the separator themselves
+		id.Picker = PickerKind(payload[0])
+		id.RoleName = strings.Join(payload[1:], customIDSeparator)
+		if id.RoleName == "" {
+			return CustomID{}, fmt.Errorf("%w: %s has no role name", ErrUnknownCustomID, s)
+		}
+	case VerifyInGuildButtonID:
+		if len(payload) < 1 {
+			return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+		}
+
+		guildSnowflake, err := discord.ParseSnowflake(payload[0])
+		if err != nil {
+			return CustomID{}, fmt.Errorf("%w: %s has an invalid guild ID: %v", ErrUnknownCustomID, s, err)
+		}
+
+		id.GuildID = discord.GuildID(guildSnowflake)
+	case SetupSelectID, SetupButtonID:
+		if len(payload) != 1 {
+			return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+		}
+
+		id.Step = payload[0]
+	case VerifyButtonID, VerifiedButtonID, CustomColourButtonID, CustomColourModalID, GarbageRolesConfirmID:
+		// these don't carry anything else
+	default:
+		return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+	}
+
+	return id, nil
+}
+
+// decodeLegacyCustomID decodes a custom ID from before custom IDs were versioned.
+func decodeLegacyCustomID(s string) (CustomID, error) {
+	if idType, ok := legacyCustomIDs[s]; ok {
+		return CustomID{Type: idType}, nil
+	}
+
+	for prefix, kind := range legacyCustomIDPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return CustomID{Type: PickerButtonID, Picker: kind, RoleName: strings.TrimPrefix(s, prefix)}, nil
+		}
+	}
+
+	// Legacy DM verification buttons were never signed, so we only trust them if
+	// signing hasn't been set up.
+	if strings.HasPrefix(s, "verifyme_button_guild_") && customIDSecret() == "" {
+		guildSnowflake, err := discord.ParseSnowflake(strings.TrimPrefix(s, "verifyme_button_guild_"))
+		if err != nil {
+			return CustomID{}, fmt.Errorf("%w: %s has an invalid guild ID: %v", ErrUnknownCustomID, s, err)
+		}
+
+		return CustomID{Type: VerifyInGuildButtonID, GuildID: discord.GuildID(guildSnowflake)}, nil
+	}
+
+	return CustomID{}, fmt.Errorf("%w: %s", ErrUnknownCustomID, s)
+}
+
+// customIDSecret returns the secret custom IDs are signed with, from $CUSTOM_ID_SECRET.
+func customIDSecret() string {
+	return os.Getenv("CUSTOM_ID_SECRET")
+}
+
+// signCustomID returns the signature for an encoded custom ID, or an empty string
+// if there's no secret to sign it with.
+func signCustomID(encoded string) string {
+	secret := customIDSecret()
+	if secret == "" {
+		return ""
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:customIDSignatureLength])
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// withCustomIDSecret sets $CUSTOM_ID_SECRET for the length of a test.
+func withCustomIDSecret(t *testing.T, secret string) {
+	previous, wasSet := os.LookupEnv("CUSTOM_ID_SECRET")
+	os.Setenv("CUSTOM_ID_SECRET", secret)
+	t.Cleanup(func() {
+		if wasSet {
+			os.Setenv("CUSTOM_ID_SECRET", previous)
+		} else {
+			os.Unsetenv("CUSTOM_ID_SECRET")
+		}
+	})
+}
+
+func TestCustomIDRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		id   CustomID
+		want discord.ComponentID
+	}{
+		{"picker button", CustomID{Type: PickerButtonID, Picker: ColourPicker, RoleID: 123}, "v1:pick:colour:123"},
+		{"picker role name button", CustomID{Type: PickerRoleNameButtonID, Picker: RolePicker, RoleName: "gaming"}, "v1:pickname:role:gaming"},
+		{"role name with separator", CustomID{Type: PickerRoleNameButtonID, Picker: PronounPicker, RoleName: "she:her"}, "v1:pickname:pronoun:she:her"},
+		{"verify button", CustomID{Type: VerifyButtonID}, "v1:verify"},
+		{"verify in guild button", CustomID{Type: VerifyInGuildButtonID, GuildID: 456}, "v1:verifyin:456"},
+		{"garbage roles confirm", CustomID{Type: GarbageRolesConfirmID}, "v1:gcconfirm"},
+		{"setup select", CustomID{Type: SetupSelectID, Step: "roles"}, "v1:setup:roles"},
+		{"setup button", CustomID{Type: SetupButtonID, Step: "save"}, "v1:setupnav:save"},
+	}
+
+	withCustomIDSecret(t, "")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := test.id.Encode()
+			if encoded != test.want {
+				t.Errorf("Encode() = %q, want %q", encoded, test.want)
+			}
+
+			decoded, err := DecodeCustomID(encoded)
+			if err != nil {
+				t.Fatalf("DecodeCustomID(%q) failed with error %v", encoded, err)
+			}
+			if decoded != test.id {
+				t.Errorf("DecodeCustomID(%q) = %+v, want %+v", encoded, decoded, test.id)
+			}
+		})
+	}
+}
+
+func TestDecodeLegacyCustomID(t *testing.T) {
+	tests := []struct {
+		raw  discord.ComponentID
+		want CustomID
+	}{
+		{"colour_button_hot pink", CustomID{Type: PickerButtonID, Picker: ColourPicker, RoleName: "hot pink"}},
+		{"pronoun_button_they/them", CustomID{Type: PickerButtonID, Picker: PronounPicker, RoleName: "they/them"}},
+		{"role_button_gaming", CustomID{Type: PickerButtonID, Picker: RolePicker, RoleName: "gaming"}},
+		{"verifyme_button", CustomID{Type: VerifyButtonID}},
+		{"gc_roles_confirm", CustomID{Type: GarbageRolesConfirmID}},
+		{"verifyme_button_guild_789", CustomID{Type: VerifyInGuildButtonID, GuildID: 789}},
+	}
+
+	withCustomIDSecret(t, "")
+	for _, test := range tests {
+		t.Run(string(test.raw), func(t *testing.T) {
+			decoded, err := DecodeCustomID(test.raw)
+			if err != nil {
+				t.Fatalf("DecodeCustomID(%q) failed with error %v", test.raw, err)
+			}
+			if decoded != test.want {
+				t.Errorf("DecodeCustomID(%q) = %+v, want %+v", test.raw, decoded, test.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCustomIDRejects(t *testing.T) {
+	withCustomIDSecret(t, "secret")
+	signed := string(CustomID{Type: VerifyInGuildButtonID, GuildID: 456}.Encode())
+	signature := signed[strings.LastIndex(signed, customIDSeparator)+1:]
+
+	tests := []struct {
+		name string
+		raw  discord.ComponentID
+	}{
+		{"unsigned", "v1:verifyin:456"},
+		{"signature for another guild", discord.ComponentID("v1:verifyin:457:" + signature)},
+		{"tampered signature", discord.ComponentID(signed[:len(signed)-1] + "x")},
+		{"legacy guild button once signing is set up", "verifyme_button_guild_456"},
+		{"unknown type", "v1:nonsense"},
+		{"picker button without a role", "v1:pick:colour"},
+		{"picker button with an invalid role", "v1:pick:colour:pink"},
+		{"picker role name button without a name", "v1:pickname:colour:"},
+		{"setup button without a step", "v1:setupnav"},
+		{"unknown legacy ID", "something_else"},
+	}
+
+	if _, err := DecodeCustomID(discord.ComponentID(signed)); err != nil {
+		t.Fatalf("DecodeCustomID(%q) failed with error %v", signed, err)
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := DecodeCustomID(test.raw); !errors.Is(err, ErrUnknownCustomID) {
+				t.Errorf("DecodeCustomID(%q) returned error %v, want ErrUnknownCustomID", test.raw, err)
+			}
+		})
+	}
+}
@@ -2,8 +2,6 @@ package main
 
 import (
 	"log"
-	"reflect"
-	"strings"
 
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
@@ -17,92 +15,172 @@ type Dispatcher struct {
 }
 
 // InteractionEventDispatcher fires when an InteractionCreateEvent occurs, and dispatches
-// the relevant events to the bot.
+// the relevant events to the bot through the interaction middleware.
 func (d *Dispatcher) InteractionEventDispatcher(e *gateway.InteractionCreateEvent) {
+	handler := chainInteractionMiddleware(d.dispatchInteraction,
+		logInteractions,
+		d.Bot.autoDeferInteractions,
+		d.Bot.respondOnInteractionError,
+		recoverInteractionPanics,
+	)
+
+	// errors have already been logged and reported to the user by the middleware
+	handler(e)
+}
+
+// dispatchInteraction works out what an interaction is for, and sends it to the relevant part of the bot.
+func (d *Dispatcher) dispatchInteraction(e *gateway.InteractionCreateEvent) error {
 	var err error
 	switch data := e.Data.(type) {
 	case *discord.CommandInteraction:
 		if e.GuildID == 0 {
 			// not in a guild? waa
-			return
+			return nil
+		}
+
+		command := findCommand(commandInteractionType(data), data.Name)
+		if command == nil {
+			return nil
 		}
 
 		var guild *discord.Guild
 		guild, err = d.Bot.State.Guild(e.GuildID)
 		if err != nil {
-			return
+			return err
 		}
 
-		if guild.OwnerID != e.Member.User.ID {
+		var allowed bool
+		allowed, err = d.Bot.memberHasCapability(*guild, *e.Member, command.Capability)
+		if err != nil {
+			log.Println("Failed checking permissions for command", data.Name, "with error", err)
+		}
+
+		if !allowed {
 			data := api.InteractionResponse{
 				Type: api.MessageInteractionWithSource,
 				Data: &api.InteractionResponseData{
-					Content: option.NewNullableString("You're not authorised to run that command :c sorry! Ask your server owner."),
+					Content: option.NewNullableString("You're not authorised to run that command :c sorry! Ask a committee member."),
 					Flags:   api.EphemeralResponse,
 				},
 			}
 
-			if err = d.Bot.State.RespondInteraction(e.ID, e.Token, data); err != nil {
+			if err = d.Bot.responder(e).Respond(data); err != nil {
 				log.Println("failed to send interaction callback for failed interaction:", err)
 			}
-			return
+			return nil
 		}
 
-		switch data.Name {
-		case "verification_button":
-			err = d.Bot.CreateVerificationButton(e)
-		case "pronoun_picker":
-			err = d.Bot.CreatePronounPicker(e, *guild)
-		case "colour_picker":
-			err = d.Bot.CreateColourPicker(e, *guild)
-		case "role_picker":
-			err = d.Bot.CreateRolePicker(e, *guild)
-		default:
-			return
+		err = command.Run(&d.Bot, e, data)
+	case *discord.AutocompleteInteraction:
+		if e.GuildID == 0 {
+			return nil
 		}
-	case *discord.ButtonInteraction:
-		s := string(data.CustomID)
-		switch {
-		case strings.HasPrefix(s, colour_button_prefix):
-			err = d.Bot.InteractionToggleUserRole(e, e.Member, strings.TrimPrefix(s, colour_button_prefix), e.GuildID, "requested colour role")
-		case strings.HasPrefix(s, pronoun_button_prefix):
-			err = d.Bot.InteractionToggleUserRole(e, e.Member, strings.TrimPrefix(s, pronoun_button_prefix), e.GuildID, "requested pronoun role")
-		case strings.HasPrefix(s, role_button_prefix):
-			err = d.Bot.InteractionToggleUserRole(e, e.Member, strings.TrimPrefix(s, role_button_prefix), e.GuildID, "requested generic role")
-		case strings.HasPrefix(s, verify_button_guild_prefix):
-			var guildSnowflake discord.Snowflake
-			guildSnowflake, err = discord.ParseSnowflake(strings.TrimPrefix(s, verify_button_guild_prefix))
-			if err != nil {
-				log.Fatalln("Invalid guild ID found for button with text", s)
-			}
 
-			// Send an interaction as we start the verification process to acknowledge the button
-			d.Bot.State.RespondInteraction(e.ID, e.Token, api.InteractionResponse{
-				Type: api.MessageInteractionWithSource,
-				Data: &api.InteractionResponseData{
-					Content: option.NewNullableString("Verification started! Your verified role has been removed temporarily while you verify yourself - as soon as this is done, it'll be back 😄"),
-					Flags:   api.EphemeralResponse,
-				},
-			})
+		command := findCommand(data.CommandType, data.Name)
+		if command == nil {
+			return nil
+		}
+
+		// members who can't run the command don't get any hints about it either
+		var guild *discord.Guild
+		guild, err = d.Bot.State.Guild(e.GuildID)
+		if err != nil {
+			return err
+		}
 
-			err = d.Bot.VerifyUser(*e.User, discord.GuildID(guildSnowflake))
-		case s == "verifyme_button":
-			err = d.Bot.OnVerifyMeButton(e)
-		default:
-			return
+		var allowed bool
+		allowed, err = d.Bot.memberHasCapability(*guild, *e.Member, command.Capability)
+		if err != nil {
+			return err
+		}
+
+		choices := api.AutocompleteStringChoices{}
+		if allowed {
+			choices, err = command.Complete(&d.Bot, e, data)
+			if err != nil {
+				return err
+			}
 		}
+
+		err = d.Bot.State.RespondInteraction(e.ID, e.Token, api.InteractionResponse{
+			Type: api.AutocompleteResult,
+			Data: &api.InteractionResponseData{
+				Choices: choices,
+			},
+		})
+	case *discord.ButtonInteraction:
+		err = d.routeComponent(e, data.CustomID)
+	case *discord.SelectInteraction:
+		err = d.routeComponent(e, data.CustomID)
+	case *discord.ModalInteraction:
+		err = d.routeComponent(e, data.CustomID)
 	default:
-		return
+		return nil
 	}
+
+	return err
+}
+
+// ComponentHandler handles an interaction from a component or modal, given its decoded custom ID.
+type ComponentHandler func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error
+
+// componentRoutes maps each type of custom ID to the handler for its interactions.
+var componentRoutes = map[CustomIDType]ComponentHandler{
+	PickerButtonID:         (*Bot).OnPickerButton,
+	PickerRoleNameButtonID: (*Bot).OnPickerButton,
+	VerifyButtonID:         func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error { return bot.OnVerifyMeButton(e) },
+	VerifyInGuildButtonID:  (*Bot).OnVerifyInGuildButton,
+	// VerifyUser waits for this button itself, and responds to it
+	VerifiedButtonID: func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error { return nil },
+	CustomColourButtonID: func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error {
+		return bot.OnCustomColourButton(e)
+	},
+	CustomColourModalID: func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error {
+		return bot.OnCustomColourModal(e, e.Data.(*discord.ModalInteraction))
+	},
+	GarbageRolesConfirmID: func(bot *Bot, e *gateway.InteractionCreateEvent, id CustomID) error {
+		return bot.OnGarbageRolesConfirmButton(e)
+	},
+	SetupSelectID: (*Bot).OnSetupSelect,
+	SetupButtonID: (*Bot).OnSetupButton,
+}
+
+// routeComponent decodes a component's custom ID, and sends its interaction to the handler
+// for its type. Components the bot can't make sense of any more - from an old version of
+// the bot, or that have been tampered with - are told that they're out of date.
+func (d *Dispatcher) routeComponent(e *gateway.InteractionCreateEvent, customID discord.ComponentID) error {
+	id, err := DecodeCustomID(customID)
 	if err != nil {
-		log.Println("Error in InteractionEventDispatcher for", reflect.TypeOf(e), "of error", err)
+		log.Println("Ignoring component with error", err)
+		return d.Bot.respondEphemerally(e, "Sorry, that button is out of date 😢 Ask a committee member to post a new one!")
+	}
+
+	handler, ok := componentRoutes[id.Type]
+	if !ok {
+		return d.Bot.respondEphemerally(e, "Sorry, that button is out of date 😢 Ask a committee member to post a new one!")
 	}
+
+	return handler(&d.Bot, e, id)
+}
+
+// eventHandler wraps a gateway event handler in the event middleware.
+func eventHandler(handler EventHandler) EventHandler {
+	return chainEventMiddleware(handler,
+		logEventErrors,
+		recoverEventPanics,
+	)
 }
 
 // NewGuildMemberEventDispatcher fires when a new guild member joins.
 func (d *Dispatcher) NewGuildMemberEventDispatcher(newMemberEvent *gateway.GuildMemberAddEvent) {
-	err := d.Bot.VerifyUser(newMemberEvent.User, newMemberEvent.GuildID)
-	if err != nil {
-		log.Println("Error in NewGuildMemberEventDispatcher:", err)
-	}
+	eventHandler(func(event interface{}) error {
+		return d.Bot.VerifyUser(newMemberEvent.User, newMemberEvent.GuildID)
+	})(newMemberEvent)
+}
+
+// GuildMemberRemoveEventDispatcher fires when a member leaves a guild.
+func (d *Dispatcher) GuildMemberRemoveEventDispatcher(memberRemoveEvent *gateway.GuildMemberRemoveEvent) {
+	eventHandler(func(event interface{}) error {
+		return d.Bot.OnGuildMemberRemove(memberRemoveEvent.GuildID, memberRemoveEvent.User)
+	})(memberRemoveEvent)
 }
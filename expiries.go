@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// roleExpiriesFile is the data file that pending role expiries are kept in.
+const roleExpiriesFile = "role_expiries.json"
+
+// roleExpiryCheckInterval is how often the scheduler checks for due expiries, unless it's configured otherwise.
+const roleExpiryCheckInterval = time.Minute
+
+// maxRoleExpiryBackoff is the longest an expiry that keeps failing waits before it's
+// tried again.
+const maxRoleExpiryBackoff = 24 * time.Hour
+
+// RoleExpiry records a role that a member has been given for a limited time.
+type RoleExpiry struct {
+	GuildID   discord.GuildID `json:"guildID"`
+	UserID    discord.UserID  `json:"userID"`
+	RoleID    discord.RoleID  `json:"roleID"`
+	ExpiresAt time.Time       `json:"expiresAt"`
+	// Failures counts how many times removing the role has failed, and RetryAt is when
+	// it's next tried, backing off further each time.
+	Failures int       `json:"failures,omitempty"`
+	RetryAt  time.Time `json:"retryAt,omitempty"`
+}
+
+// dueAt returns when the expiry should next be tried.
+func (e RoleExpiry) dueAt() time.Time {
+	if e.RetryAt.After(e.ExpiresAt) {
+		return e.RetryAt
+	}
+	return e.ExpiresAt
+}
+
+// backedOff returns the expiry after it's failed again, to be retried after waiting twice
+// as long as last time.
+func (e RoleExpiry) backedOff(now time.Time) RoleExpiry {
+	backoff := roleExpiryCheckInterval
+	for i := 0; i < e.Failures && backoff < maxRoleExpiryBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxRoleExpiryBackoff {
+		backoff = maxRoleExpiryBackoff
+	}
+	e.Failures++
+	e.RetryAt = now.Add(backoff)
+	return e
+}
+
+// roleExpiries holds every pending role expiry, guarded by roleExpiriesMutex.
+var roleExpiries []RoleExpiry
+var roleExpiriesMutex sync.Mutex
+
+// roleExpiriesChanged wakes the scheduler's expiries job when a new expiry is added,
+// in case it's due sooner than whatever the scheduler is waiting for.
+var roleExpiriesChanged = make(chan struct{}, 1)
+
+// loadRoleExpiries reads the pending role expiries in from the data directory.
+func loadRoleExpiries() error {
+	roleExpiriesMutex.Lock()
+	defer roleExpiriesMutex.Unlock()
+
+	return loadJSON(roleExpiriesFile, &roleExpiries)
+}
+
+// scheduleRoleExpiry records that a member's role should be removed at the given
+// time, replacing any expiry already scheduled for that member and role.
+func scheduleRoleExpiry(guildID discord.GuildID, userID discord.UserID, roleID discord.RoleID, expiresAt time.Time) error {
+	roleExpiriesMutex.Lock()
+	defer roleExpiriesMutex.Unlock()
+
+	roleExpiries = withoutRoleExpiry(roleExpiries, guildID, userID, roleID)
+	roleExpiries = append(roleExpiries, RoleExpiry{
+		GuildID:   guildID,
+		UserID:    userID,
+		RoleID:    roleID,
+		ExpiresAt: expiresAt,
+	})
+
+	select {
+	case roleExpiriesChanged <- struct{}{}:
+	default:
+		// the scheduler has already been told to wake up
+	}
+
+	return saveJSON(roleExpiriesFile, roleExpiries)
+}
+
+// cancelRoleExpiry forgets any expiry scheduled for a member's role - for example,
+// because they've removed the role themselves.
+func cancelRoleExpiry(guildID discord.GuildID, userID discord.UserID, roleID discord.RoleID) error {
+	roleExpiriesMutex.Lock()
+	defer roleExpiriesMutex.Unlock()
+
+	remaining := withoutRoleExpiry(roleExpiries, guildID, userID, roleID)
+	if len(remaining) == len(roleExpiries) {
+		return nil
+	}
+
+	roleExpiries = remaining
+	return saveJSON(roleExpiriesFile, roleExpiries)
+}
+
+// withoutRoleExpiry filters out any expiries for the given member and role.
+func withoutRoleExpiry(expiries []RoleExpiry, guildID discord.GuildID, userID discord.UserID, roleID discord.RoleID) []RoleExpiry {
+	remaining := []RoleExpiry{}
+	for _, expiry := range expiries {
+		if expiry.GuildID != guildID || expiry.UserID != userID || expiry.RoleID != roleID {
+			remaining = append(remaining, expiry)
+		}
+	}
+	return remaining
+}
+
+// nextRoleExpiry returns when the next timed role is due to expire, if there are any.
+func nextRoleExpiry() (time.Time, bool) {
+	roleExpiriesMutex.Lock()
+	defer roleExpiriesMutex.Unlock()
+
+	var next time.Time
+	for _, expiry := range roleExpiries {
+		if next.IsZero() || expiry.dueAt().Before(next) {
+			next = expiry.dueAt()
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// ExpireDueRoles removes every timed role that's due to expire, returning how many were
+// removed. Expiries that fail for reasons other than the member or role having gone are
+// kept to retry later, backing off each time so that one that keeps failing isn't
+// retried over and over.
+func (bot *Bot) ExpireDueRoles() int {
+	now := time.Now()
+
+	roleExpiriesMutex.Lock()
+	due := []RoleExpiry{}
+	for _, expiry := range roleExpiries {
+		if !expiry.dueAt().After(now) {
+			due = append(due, expiry)
+		}
+	}
+	roleExpiriesMutex.Unlock()
+
+	if len(due) == 0 {
+		return 0
+	}
+
+	expired := 0
+	for _, expiry := range due {
+		err := bot.State.RemoveRole(expiry.GuildID, expiry.UserID, expiry.RoleID, "Timed role expired")
+		failed := err != nil && !isNotFound(err)
+
+		roleExpiriesMutex.Lock()
+		remaining := []RoleExpiry{}
+		for _, pending := range roleExpiries {
+			// an expiry might have been rescheduled while we weren't holding the lock, so check it's unchanged
+			if pending != expiry {
+				remaining = append(remaining, pending)
+			} else if failed {
+				retry := pending.backedOff(now)
+				log.Println("Failed removing expired role", expiry.RoleID, "from user", expiry.UserID, "in guild", expiry.GuildID,
+					"with error", err, "- trying again at", retry.RetryAt.Format(time.RFC3339))
+				remaining = append(remaining, retry)
+			}
+		}
+		roleExpiries = remaining
+		roleExpiriesMutex.Unlock()
+
+		if !failed {
+			expired++
+		}
+	}
+
+	roleExpiriesMutex.Lock()
+	defer roleExpiriesMutex.Unlock()
+
+	if err := saveJSON(roleExpiriesFile, roleExpiries); err != nil {
+		log.Println("Failed saving role expiries with error", err)
+	}
+	return expired
+}
+
+// OnTempRoleCommand is run by the interaction event dispatcher when the command
+// to give a member a role for a limited time is activated.
+func (bot *Bot) OnTempRoleCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	userSnowflake, err := data.Options.Find("user").SnowflakeValue()
+	if err != nil {
+		return err
+	}
+
+	roleSnowflake, err := data.Options.Find("role").SnowflakeValue()
+	if err != nil {
+		return err
+	}
+
+	duration, err := parseDuration(data.Options.Find("duration").String())
+	if err != nil || duration <= 0 {
+		return bot.respondEphemerally(e, "That doesn't look like a valid duration - try something like 3h, 2d or 1w.")
+	}
+
+	userID := discord.UserID(userSnowflake)
+	roleID := discord.RoleID(roleSnowflake)
+	expiresAt := time.Now().Add(duration)
+
+	err = bot.State.AddRole(e.GuildID, userID, roleID, api.AddRoleData{
+		AuditLogReason: api.AuditLogReason(fmt.Sprintf("Temporary role given by %s until %s", e.Member.User.Username, expiresAt.Format(time.RFC822))),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := scheduleRoleExpiry(e.GuildID, userID, roleID, expiresAt); err != nil {
+		return err
+	}
+
+	return bot.respondEphemerally(e, fmt.Sprintf("Done! %s has %s until <t:%d:f>.", userID.Mention(), roleID.Mention(), expiresAt.Unix()))
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRoleExpiryBackoff(t *testing.T) {
+	now := time.Date(2024, time.January, 10, 12, 0, 0, 0, time.UTC)
+	expiry := RoleExpiry{GuildID: 1, UserID: 2, RoleID: 3, ExpiresAt: now.Add(-time.Hour)}
+	if due := expiry.dueAt(); !due.Equal(expiry.ExpiresAt) {
+		t.Errorf("dueAt() = %v before failing, want %v", due, expiry.ExpiresAt)
+	}
+
+	wants := []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute, 8 * time.Minute}
+	for i, want := range wants {
+		expiry = expiry.backedOff(now)
+		if expiry.Failures != i+1 {
+			t.Errorf("Failures = %d after failing %d times", expiry.Failures, i+1)
+		}
+		if due := expiry.dueAt(); !due.Equal(now.Add(want)) {
+			t.Errorf("dueAt() = %v after failing %d times, want %v", due, i+1, now.Add(want))
+		}
+	}
+
+	for i := 0; i < 100; i++ {
+		expiry = expiry.backedOff(now)
+	}
+	if due := expiry.dueAt(); !due.Equal(now.Add(maxRoleExpiryBackoff)) {
+		t.Errorf("dueAt() = %v after failing many times, want %v", due, now.Add(maxRoleExpiryBackoff))
+	}
+}
@@ -5,5 +5,5 @@ go 1.16
 require (
 	github.com/diamondburned/arikawa/v3 v3.0.0
 	github.com/joho/godotenv v1.4.0
-	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
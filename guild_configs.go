@@ -0,0 +1,650 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// guildConfigsFile is the data file that settings changed from Discord, and the history
+// of those changes, are kept in.
+const guildConfigsFile = "guild_configs.json"
+
+// maxPickerButtons is the most buttons a picker can have - five rows of five.
+const maxPickerButtons = 25
+
+// maxCustomColourPickerButtons is the most colours a colour picker can have when it also
+// has the custom colour button, which takes a row of its own.
+const maxCustomColourPickerButtons = maxPickerButtons - 5
+
+// maxButtonLabelLength is the longest a button's label can be.
+const maxButtonLabelLength = 80
+
+// ConfigSetting is a setting that can be changed from Discord. Settings are read and
+// written as text, in the same form for both, so that a value shown by /config get
+// can be edited and given back to /config set.
+type ConfigSetting struct {
+	Key         string
+	Description string
+	// Get returns the setting's value in a config.
+	Get func(c Config, guildID discord.GuildID) string
+	// Apply parses a value for the setting, and puts it in place in a config.
+	Apply func(c *Config, guildID discord.GuildID, value string) error
+	// Validate, if set, checks that a value refers to things that exist in Discord.
+	Validate func(bot *Bot, guildID discord.GuildID, value string) error
+}
+
+// ConfigChange records a change made to a setting from Discord.
+type ConfigChange struct {
+	GuildID   discord.GuildID `json:"guildID,omitempty"`
+	Key       string          `json:"key"`
+	OldValue  string          `json:"oldValue"`
+	NewValue  string          `json:"newValue"`
+	ChangedBy discord.UserID  `json:"changedBy"`
+	ChangedAt time.Time       `json:"changedAt"`
+}
+
+// StoredConfig holds the settings that have been changed from Discord, and the history
+// of changes. Settings are stored by guild then key.
+type StoredConfig struct {
+	Settings map[discord.GuildID]map[string]string `json:"settings"`
+	History  []ConfigChange                        `json:"history"`
+}
+
+// storedConfig holds the settings changed from Discord, guarded by storedConfigMutex.
+var storedConfig = StoredConfig{Settings: map[discord.GuildID]map[string]string{}}
+var storedConfigMutex sync.Mutex
+
+// fileConfig is the config as it was read from config.yml, before the settings changed
+// from Discord are applied on top of it. It's guarded by storedConfigMutex.
+var fileConfig Config
+
+// configSettings are the settings that can be changed from Discord, by key. Their keys
+// match the names they're given in config.yml.
+var configSettings = []ConfigSetting{
+	{
+		Key:         "alumniGuild",
+		Description: "Whether the server is for alumni rather than current students - true or false",
+		Get: func(c Config, guildID discord.GuildID) string {
+			return strconv.FormatBool(c.Guilds[guildID].AlumniGuild)
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			alumni, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%q should be true or false", value)
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.AlumniGuild = alumni })
+			return nil
+		},
+	},
+	{
+		Key:         "verifiedRole",
+		Description: "The role verified members get - a role mention or ID, or none to use the role called verified",
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatOptionalID(discord.Snowflake(c.Guilds[guildID].VerifiedRole))
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			roleID, err := parseOptionalID(value, "<@&")
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.VerifiedRole = discord.RoleID(roleID) })
+			return nil
+		},
+		Validate: func(bot *Bot, guildID discord.GuildID, value string) error {
+			roleID, _ := parseOptionalID(value, "<@&")
+			if !roleID.IsValid() {
+				return nil
+			}
+			if _, err := bot.State.Role(guildID, discord.RoleID(roleID)); err != nil {
+				return fmt.Errorf("there's no role with the ID %s in this server", roleID)
+			}
+			return nil
+		},
+	},
+	{
+		Key:         "colours",
+		Description: `The roles the colour picker offers - a list of names like ["Red", "Dark blue"], or names separated by commas`,
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatNameList(c.Guilds[guildID].Colours)
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			names, err := parseRoleNameList(value)
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.Colours = names })
+			return nil
+		},
+	},
+	{
+		Key:         "customColours",
+		Description: "Whether the colour picker lets members type in their own colour - true or false",
+		Get: func(c Config, guildID discord.GuildID) string {
+			return strconv.FormatBool(c.Guilds[guildID].CustomColours)
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			customColours, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%q should be true or false", value)
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.CustomColours = customColours })
+			return nil
+		},
+	},
+	{
+		Key:         "roles",
+		Description: `The roles the main role picker offers - a list of names like ["Gaming", "Film"], or names separated by commas`,
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatNameList(RoleNames(c.Guilds[guildID].Roles))
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			names, err := parseRoleNameList(value)
+			if err != nil {
+				return err
+			}
+			// prerequisites for roles can only be set in config.yml, so keep hold of them
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.Roles = keepRoleConfigs(g.Roles, names) })
+			return nil
+		},
+	},
+	{
+		Key:         "channels",
+		Description: "The channels to reap, and how long each keeps messages for - like #general=7d, #memes=12h",
+		Get: func(c Config, guildID discord.GuildID) string {
+			channels := []string{}
+			for channelID, channelConfig := range c.Guilds[guildID].Channels {
+				channels = append(channels, fmt.Sprintf("%s=%s", channelID.Mention(), formatDuration(time.Duration(channelConfig.ReapDuration))))
+			}
+			sort.Strings(channels)
+			return strings.Join(channels, ", ")
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			channels, err := parseReapChannels(value)
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) {
+				// archiving, keep rules and stale threads can only be set in config.yml, so keep hold of them for channels still reaped
+				for channelID, channelConfig := range channels {
+					if existing, ok := g.Channels[channelID]; ok {
+						existing.ReapDuration = channelConfig.ReapDuration
+						channels[channelID] = existing
+					}
+				}
+				g.Channels = channels
+			})
+			return nil
+		},
+		Validate: func(bot *Bot, guildID discord.GuildID, value string) error {
+			channels, _ := parseReapChannels(value)
+			for channelID := range channels {
+				channel, err := bot.State.Channel(channelID)
+				if err != nil || channel.GuildID != guildID {
+					return fmt.Errorf("there's no channel with the ID %s in this server", channelID)
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Key:         "reportChannel",
+		Description: "The channel reported messages are posted to - a channel mention or ID, or none",
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatOptionalID(discord.Snowflake(c.Guilds[guildID].ReportChannel))
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			channelID, err := parseOptionalID(value, "<#")
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.ReportChannel = discord.ChannelID(channelID) })
+			return nil
+		},
+		Validate: validateOptionalChannel,
+	},
+	{
+		Key:         "reaperLogChannel",
+		Description: "The channel summaries of what the reaper did are posted to - a channel mention or ID, or none",
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatOptionalID(discord.Snowflake(c.Guilds[guildID].ReaperLogChannel))
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			channelID, err := parseOptionalID(value, "<#")
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.ReaperLogChannel = discord.ChannelID(channelID) })
+			return nil
+		},
+		Validate: validateOptionalChannel,
+	},
+	{
+		Key:         "pronouns",
+		Description: `The pronouns the pronoun picker offers - a list like ["she/her", "they/them"], or separated by commas, or empty for the ones in config.yml`,
+		Get: func(c Config, guildID discord.GuildID) string {
+			return formatNameList(c.GuildPronouns(guildID))
+		},
+		Apply: func(c *Config, guildID discord.GuildID, value string) error {
+			pronouns, err := parseRoleNameList(value)
+			if err != nil {
+				return err
+			}
+			updateGuildConfig(c, guildID, func(g *GuildConfig) { g.Pronouns = pronouns })
+			return nil
+		},
+	},
+}
+
+// nameListSettingKeys are the keys of the settings whose values are lists of names.
+var nameListSettingKeys = []string{"colours", "roles", "pronouns"}
+
+// findConfigSetting finds the setting with the given key, or returns nil if there isn't one.
+func findConfigSetting(key string) *ConfigSetting {
+	for i := range configSettings {
+		if strings.EqualFold(configSettings[i].Key, key) {
+			return &configSettings[i]
+		}
+	}
+	return nil
+}
+
+// loadGuildConfigs reads the settings changed from Discord in from the data directory,
+// and applies them on top of the config from config.yml. Settings stored by older
+// versions of the bot are migrated first.
+func loadGuildConfigs() error {
+	storedConfigMutex.Lock()
+	defer storedConfigMutex.Unlock()
+
+	fileConfig = currentConfig()
+
+	var raw map[string]json.RawMessage
+	if err := loadJSON(guildConfigsFile, &raw); err != nil {
+		return err
+	}
+
+	stored, migrated, err := migrateStoredConfig(raw, fileConfig)
+	if err != nil {
+		return err
+	}
+	storedConfig = stored
+	if migrated {
+		if err := saveJSON(guildConfigsFile, storedConfig); err != nil {
+			return err
+		}
+	}
+
+	setCurrentConfig(applyStoredConfig(fileConfig))
+	return nil
+}
+
+// migrateStoredConfig reads stored settings in from their raw JSON, in whichever format
+// they were saved in:
+//   - the whole config of each guild set up with /setup, keyed by guild ID, from before
+//     settings were stored one by one - the settings /setup changes are kept
+//   - settings with pronouns shared by every guild, stored under the null guild ID, from
+//     before each guild had its own - they're given to every guild that doesn't have its own
+//   - lists of names joined by commas, from before they were stored as JSON lists
+//
+// It also returns whether anything was migrated, so needs saving in the current format.
+func migrateStoredConfig(raw map[string]json.RawMessage, base Config) (StoredConfig, bool, error) {
+	stored := StoredConfig{Settings: map[discord.GuildID]map[string]string{}}
+	migrated := false
+
+	_, hasSettings := raw["settings"]
+	_, hasHistory := raw["history"]
+	if hasSettings || hasHistory || len(raw) == 0 {
+		if settings, ok := raw["settings"]; ok {
+			if err := json.Unmarshal(settings, &stored.Settings); err != nil {
+				return StoredConfig{}, false, err
+			}
+		}
+		if history, ok := raw["history"]; ok {
+			if err := json.Unmarshal(history, &stored.History); err != nil {
+				return StoredConfig{}, false, err
+			}
+		}
+		if stored.Settings == nil {
+			stored.Settings = map[discord.GuildID]map[string]string{}
+		}
+	} else {
+		for key, value := range raw {
+			guildSnowflake, err := discord.ParseSnowflake(key)
+			if err != nil {
+				return StoredConfig{}, false, fmt.Errorf("%s isn't in a format the bot understands: %q isn't a guild ID", guildConfigsFile, key)
+			}
+			guildID := discord.GuildID(guildSnowflake)
+
+			var guildConfig GuildConfig
+			if err := json.Unmarshal(value, &guildConfig); err != nil {
+				return StoredConfig{}, false, fmt.Errorf("failed reading guild %s from %s: %w", guildID, guildConfigsFile, err)
+			}
+
+			setUp := Config{Guilds: GuildConfigs{guildID: guildConfig}}
+			stored.Settings[guildID] = map[string]string{}
+			for _, key := range setupSettingKeys {
+				stored.Settings[guildID][key] = findConfigSetting(key).Get(setUp, guildID)
+			}
+			log.Println("Migrated the config of guild", guildID, "set up with /setup to settings")
+		}
+		migrated = true
+	}
+
+	if shared, ok := stored.Settings[discord.NullGuildID]; ok {
+		delete(stored.Settings, discord.NullGuildID)
+		if pronouns, ok := shared["pronouns"]; ok {
+			guildIDs := map[discord.GuildID]bool{}
+			for guildID := range base.Guilds {
+				guildIDs[guildID] = true
+			}
+			for guildID := range stored.Settings {
+				guildIDs[guildID] = true
+			}
+
+			for guildID := range guildIDs {
+				if _, own := stored.Settings[guildID]["pronouns"]; own {
+					continue
+				}
+				if stored.Settings[guildID] == nil {
+					stored.Settings[guildID] = map[string]string{}
+				}
+				stored.Settings[guildID]["pronouns"] = pronouns
+			}
+			log.Println("Migrated the pronouns shared by every guild to each guild's own settings")
+		}
+		migrated = true
+	}
+
+	for guildID, settings := range stored.Settings {
+		for _, key := range nameListSettingKeys {
+			value, ok := settings[key]
+			if !ok || isNameList(value) {
+				continue
+			}
+			// names that are too long or too many are left for applyStoredConfig to log and skip
+			if names, err := parseRoleNameList(value); err == nil {
+				settings[key] = formatNameList(names)
+				log.Println("Migrated the setting", key, "of guild", guildID, "to a list")
+				migrated = true
+			}
+		}
+	}
+
+	return stored, migrated, nil
+}
+
+// applyStoredConfig returns a copy of a config with the settings changed from Discord
+// applied on top. Settings that no longer apply are logged and skipped.
+// storedConfigMutex must be held.
+func applyStoredConfig(base Config) Config {
+	c := Config{
+		Guilds:   map[discord.GuildID]GuildConfig{},
+		Pronouns: append([]string(nil), base.Pronouns...),
+		// jobs can only be set in config.yml, and are never changed in place
+		Jobs: base.Jobs,
+	}
+	for guildID, guildConfig := range base.Guilds {
+		c.Guilds[guildID] = guildConfig.clone()
+	}
+
+	for guildID, settings := range storedConfig.Settings {
+		for key, value := range settings {
+			setting := findConfigSetting(key)
+			if setting == nil {
+				log.Println("Ignoring unknown stored setting", key, "for guild", guildID)
+				continue
+			}
+
+			if err := setting.Apply(&c, guildID, value); err != nil {
+				log.Println("Ignoring stored setting", key, "for guild", guildID, "with error", err)
+			}
+		}
+	}
+
+	return c
+}
+
+// errInconsistentSettings is returned when changing settings would leave the config
+// inconsistent, so they're not changed.
+var errInconsistentSettings = errors.New("those settings don't work together")
+
+// errInvalidSetting is returned when a setting's value can't be used, so nothing's changed.
+var errInvalidSetting = errors.New("invalid value")
+
+// setConfigValues changes settings for a guild, recording who changed them in the
+// history, and starts using them straight away. values maps setting keys to their
+// new values, which should already have been validated against Discord. Settings
+// whose values don't change aren't recorded.
+func setConfigValues(guildID discord.GuildID, changedBy discord.UserID, values map[string]string) error {
+	storedConfigMutex.Lock()
+	defer storedConfigMutex.Unlock()
+
+	current := currentConfig()
+	now := time.Now()
+
+	// the changes are undone if they leave the config inconsistent, such as too many colours for the custom colour button
+	previousSettings, hadSettings := map[string]string{}, storedConfig.Settings[guildID] != nil
+	for key, value := range storedConfig.Settings[guildID] {
+		previousSettings[key] = value
+	}
+	previousHistory := len(storedConfig.History)
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// every value's applied to a scratch config first, as applyStoredConfig skips values that don't parse
+	scratch := Config{Guilds: map[discord.GuildID]GuildConfig{guildID: current.Guilds[guildID].clone()}}
+	for _, key := range keys {
+		setting := findConfigSetting(key)
+		if setting == nil {
+			return fmt.Errorf("unknown setting %q", key)
+		}
+		if err := setting.Apply(&scratch, guildID, values[key]); err != nil {
+			return fmt.Errorf("%w for %s: %v", errInvalidSetting, setting.Key, err)
+		}
+	}
+
+	for _, key := range keys {
+		setting := findConfigSetting(key)
+		oldValue := setting.Get(current, guildID)
+		if oldValue == values[key] {
+			continue
+		}
+
+		if storedConfig.Settings[guildID] == nil {
+			storedConfig.Settings[guildID] = map[string]string{}
+		}
+		storedConfig.Settings[guildID][setting.Key] = values[key]
+		storedConfig.History = append(storedConfig.History, ConfigChange{
+			GuildID:   guildID,
+			Key:       setting.Key,
+			OldValue:  oldValue,
+			NewValue:  values[key],
+			ChangedBy: changedBy,
+			ChangedAt: now,
+		})
+	}
+
+	updated := applyStoredConfig(fileConfig)
+	if err := validateConfig(updated); err != nil {
+		if hadSettings {
+			storedConfig.Settings[guildID] = previousSettings
+		} else {
+			delete(storedConfig.Settings, guildID)
+		}
+		storedConfig.History = storedConfig.History[:previousHistory]
+		return fmt.Errorf("%w: %v", errInconsistentSettings, err)
+	}
+
+	if err := saveJSON(guildConfigsFile, storedConfig); err != nil {
+		return err
+	}
+
+	setCurrentConfig(updated)
+	return nil
+}
+
+// parseConfigValue checks that a value is valid for a setting, both in form and against
+// Discord, and returns it in its canonical form - the form Get returns it in.
+func (bot *Bot) parseConfigValue(setting ConfigSetting, guildID discord.GuildID, value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	// apply the value to a scratch config, to check it parses and to canonicalise it
+	scratch := Config{Guilds: map[discord.GuildID]GuildConfig{guildID: currentConfig().Guilds[guildID].clone()}}
+	if err := setting.Apply(&scratch, guildID, value); err != nil {
+		return "", err
+	}
+
+	if setting.Validate != nil {
+		if err := setting.Validate(bot, guildID, value); err != nil {
+			return "", err
+		}
+	}
+
+	return setting.Get(scratch, guildID), nil
+}
+
+// configHistory returns the changes made to a guild's settings, newest first.
+func configHistory(guildID discord.GuildID) []ConfigChange {
+	storedConfigMutex.Lock()
+	defer storedConfigMutex.Unlock()
+
+	changes := []ConfigChange{}
+	for i := len(storedConfig.History) - 1; i >= 0; i-- {
+		change := storedConfig.History[i]
+		if change.GuildID == guildID {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// updateGuildConfig changes a guild's config in c, which must not be the config in use.
+func updateGuildConfig(c *Config, guildID discord.GuildID, update func(g *GuildConfig)) {
+	guildConfig := c.Guilds[guildID]
+	update(&guildConfig)
+	c.Guilds[guildID] = guildConfig
+}
+
+// formatNameList formats a list of names as a JSON list, so that names with commas in
+// them can be told apart.
+func formatNameList(names []string) string {
+	if names == nil {
+		names = []string{}
+	}
+	var b strings.Builder
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// a list of strings always encodes, so there's no error to handle
+	encoder.Encode(names)
+	return strings.TrimSpace(b.String())
+}
+
+// isNameList returns whether a value is a JSON list of names.
+func isNameList(value string) bool {
+	var names []string
+	return json.Unmarshal([]byte(value), &names) == nil && names != nil
+}
+
+// parseRoleNameList parses a list of names for picker buttons - either a JSON list, or
+// names separated by commas, as they're easier to type by hand.
+func parseRoleNameList(value string) ([]string, error) {
+	var given []string
+	if err := json.Unmarshal([]byte(value), &given); err != nil || given == nil {
+		given = strings.Split(value, ",")
+	}
+
+	names := []string{}
+	for _, name := range given {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if len(name) > maxButtonLabelLength {
+			return nil, fmt.Errorf("%q is too long - names can be at most %d characters", name, maxButtonLabelLength)
+		}
+		names = append(names, name)
+	}
+
+	if len(names) > maxPickerButtons {
+		return nil, fmt.Errorf("there can be at most %d, but there are %d", maxPickerButtons, len(names))
+	}
+	return names, nil
+}
+
+// parseOptionalID parses a snowflake given as an ID or a mention starting with mentionPrefix,
+// or "none" for no ID.
+func parseOptionalID(value string, mentionPrefix string) (discord.Snowflake, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.EqualFold(value, "none") {
+		return discord.NullSnowflake, nil
+	}
+
+	value = strings.TrimSuffix(strings.TrimPrefix(value, mentionPrefix), ">")
+	id, err := discord.ParseSnowflake(value)
+	if err != nil {
+		return discord.NullSnowflake, fmt.Errorf("%q isn't a valid mention or ID", value)
+	}
+	return id, nil
+}
+
+// formatOptionalID formats an ID for display as a setting value, or "none" if it isn't set.
+func formatOptionalID(id discord.Snowflake) string {
+	if !id.IsValid() {
+		return "none"
+	}
+	return id.String()
+}
+
+// parseReapChannels parses a comma separated list of channel=duration pairs.
+func parseReapChannels(value string) (map[discord.ChannelID]ChannelConfig, error) {
+	channels := map[discord.ChannelID]ChannelConfig{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("%q should be a channel and a duration, like #general=7d", pair)
+		}
+
+		channelID, err := parseOptionalID(parts[0], "<#")
+		if err != nil || !channelID.IsValid() {
+			return nil, fmt.Errorf("%q isn't a valid channel mention or ID", parts[0])
+		}
+
+		duration, err := parseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%q isn't a valid duration - try something like 12h, 7d or 2w", parts[1])
+		}
+
+		channels[discord.ChannelID(channelID)] = ChannelConfig{ReapDuration: Duration(duration)}
+	}
+	return channels, nil
+}
+
+// validateOptionalChannel validates a setting that's either a channel in the guild, or none.
+func validateOptionalChannel(bot *Bot, guildID discord.GuildID, value string) error {
+	channelID, _ := parseOptionalID(value, "<#")
+	if !channelID.IsValid() {
+		return nil
+	}
+	channel, err := bot.State.Channel(discord.ChannelID(channelID))
+	if err != nil || channel.GuildID != guildID {
+		return fmt.Errorf("there's no channel with the ID %s in this server", channelID)
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestMigrateStoredConfig(t *testing.T) {
+	base := Config{Guilds: GuildConfigs{1: {}, 2: {}}}
+
+	tests := []struct {
+		name         string
+		raw          string
+		wantSettings map[discord.GuildID]map[string]string
+		wantMigrated bool
+	}{
+		{
+			name:         "no file",
+			raw:          `{}`,
+			wantSettings: map[discord.GuildID]map[string]string{},
+		},
+		{
+			name:         "current format",
+			raw:          `{"settings": {"1": {"colours": "[\"red\"]"}}, "history": []}`,
+			wantSettings: map[discord.GuildID]map[string]string{1: {"colours": `["red"]`}},
+		},
+		{
+			name:         "names joined by commas",
+			raw:          `{"settings": {"1": {"colours": "red, blue", "roles": "", "channels": "<#10>=7d"}}}`,
+			wantSettings: map[discord.GuildID]map[string]string{1: {"colours": `["red","blue"]`, "roles": `[]`, "channels": "<#10>=7d"}},
+			wantMigrated: true,
+		},
+		{
+			name: "guild configs from /setup",
+			raw:  `{"1": {"alumniGuild": true, "verifiedRole": "10", "colours": ["red", "blue"], "roles": [{"name": "gaming"}]}}`,
+			wantSettings: map[discord.GuildID]map[string]string{1: {
+				"verifiedRole": "10",
+				"alumniGuild":  "true",
+				"channels":     "",
+				"roles":        `["gaming"]`,
+				"colours":      `["red","blue"]`,
+			}},
+			wantMigrated: true,
+		},
+		{
+			name: "pronouns shared by every guild",
+			raw:  `{"settings": {"18446744073709551615": {"pronouns": "[\"she/her\", \"he/him\"]"}, "2": {"pronouns": "[\"they/them\"]"}}}`,
+			wantSettings: map[discord.GuildID]map[string]string{
+				1: {"pronouns": `["she/her", "he/him"]`},
+				2: {"pronouns": `["they/them"]`},
+			},
+			wantMigrated: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var raw map[string]json.RawMessage
+			if err := json.Unmarshal([]byte(test.raw), &raw); err != nil {
+				t.Fatal(err)
+			}
+
+			stored, migrated, err := migrateStoredConfig(raw, base)
+			if err != nil {
+				t.Fatalf("migrateStoredConfig failed with error %v", err)
+			}
+			if migrated != test.wantMigrated {
+				t.Errorf("migrated = %v, want %v", migrated, test.wantMigrated)
+			}
+			if !reflect.DeepEqual(stored.Settings, test.wantSettings) {
+				t.Errorf("settings = %v, want %v", stored.Settings, test.wantSettings)
+			}
+		})
+	}
+}
+
+func TestParseRoleNameList(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{value: "", want: []string{}},
+		{value: "[]", want: []string{}},
+		{value: "Red, Blue", want: []string{"Red", "Blue"}},
+		{value: `["Red, Dark", "Blue"]`, want: []string{"Red, Dark", "Blue"}},
+		{value: `[" Red ", ""]`, want: []string{"Red"}},
+		{value: "[VIP], Member", want: []string{"[VIP]", "Member"}},
+		{value: strings.Repeat("a", maxButtonLabelLength+1), wantErr: true},
+		{value: strings.Repeat("a,", maxPickerButtons+1), wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseRoleNameList(test.value)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("parseRoleNameList(%q) = %q, want an error", test.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseRoleNameList(%q) failed with error %v", test.value, err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("parseRoleNameList(%q) = %q, want %q", test.value, got, test.want)
+			}
+			if again, err := parseRoleNameList(formatNameList(got)); err != nil || !reflect.DeepEqual(again, got) {
+				t.Errorf("parseRoleNameList(formatNameList(%q)) = %q, %v, want them back", got, again, err)
+			}
+		})
+	}
+}
+
+func TestSetConfigValuesRejectsInvalidValues(t *testing.T) {
+	withDataDir(t)
+
+	storedConfigMutex.Lock()
+	previousStored, previousFile := storedConfig, fileConfig
+	storedConfig = StoredConfig{Settings: map[discord.GuildID]map[string]string{}}
+	fileConfig = Config{Guilds: GuildConfigs{1: {}}}
+	storedConfigMutex.Unlock()
+	previousConfig := currentConfig()
+	setCurrentConfig(fileConfig)
+	t.Cleanup(func() {
+		storedConfigMutex.Lock()
+		storedConfig, fileConfig = previousStored, previousFile
+		storedConfigMutex.Unlock()
+		setCurrentConfig(previousConfig)
+	})
+
+	err := setConfigValues(1, 2, map[string]string{
+		"alumniGuild": "true",
+		"colours":     strings.Repeat("a,", maxPickerButtons+1),
+	})
+	if !errors.Is(err, errInvalidSetting) {
+		t.Fatalf("setConfigValues returned error %v, want %v", err, errInvalidSetting)
+	}
+	if len(storedConfig.Settings) != 0 || len(storedConfig.History) != 0 {
+		t.Errorf("setConfigValues stored %+v, want nothing stored", storedConfig)
+	}
+	if currentConfig().Guilds[1].AlumniGuild {
+		t.Error("setConfigValues changed the config in use, want it unchanged")
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"log"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// KeepRules say which messages in a reaped channel are kept, however old they are.
+// Pinned messages and the pickers the bot has posted are always kept.
+type KeepRules struct {
+	// Reactions keeps messages with any of these reactions - unicode emoji, or the names or IDs of custom ones.
+	Reactions []string `yaml:"reactions" json:"reactions,omitempty"`
+	// Roles keeps messages by members holding any of these roles.
+	Roles []discord.RoleID `yaml:"roles" json:"roles,omitempty"`
+	// Self keeps messages sent by the bot itself.
+	Self bool `yaml:"self" json:"self,omitempty"`
+	// Attachments keeps messages with files attached.
+	Attachments bool `yaml:"attachments" json:"attachments,omitempty"`
+}
+
+// keepRule is a rule that keeps some messages from being reaped.
+type keepRule struct {
+	// Name describes the messages the rule keeps, for logging which rules kept messages.
+	Name  string
+	Keeps func(message discord.Message) bool
+}
+
+// memberRolesCache looks up and remembers the roles of the authors of messages being
+// reaped, so that each member is only looked up once per channel.
+type memberRolesCache struct {
+	bot     *Bot
+	guildID discord.GuildID
+	roles   map[discord.UserID][]discord.RoleID
+	// failed remembers the members who couldn't be looked up, and why.
+	failed map[discord.UserID]error
+}
+
+// newMemberRolesCache starts a cache of the roles of a guild's members.
+func newMemberRolesCache(bot *Bot, guildID discord.GuildID) *memberRolesCache {
+	return &memberRolesCache{
+		bot:     bot,
+		guildID: guildID,
+		roles:   map[discord.UserID][]discord.RoleID{},
+		failed:  map[discord.UserID]error{},
+	}
+}
+
+// Roles returns the roles a user holds in the guild - none if they've left it. It fails
+// if Discord can't say whether they're still in it.
+func (c *memberRolesCache) Roles(userID discord.UserID) ([]discord.RoleID, error) {
+	if roles, ok := c.roles[userID]; ok {
+		return roles, nil
+	}
+	if err, ok := c.failed[userID]; ok {
+		return nil, err
+	}
+
+	var roles []discord.RoleID
+	member, err := c.bot.State.Member(c.guildID, userID)
+	switch {
+	case err == nil:
+		roles = member.RoleIDs
+	case isUnknownMember(err):
+		// they've left, so they hold no roles
+	default:
+		log.Println("Failed looking up the roles of user", userID, "in guild", c.guildID, "with error", err)
+		c.failed[userID] = err
+		return nil, err
+	}
+	c.roles[userID] = roles
+	return roles, nil
+}
+
+// HasAnyRole checks whether the author of a message holds any of the roles given.
+// Messages sent by webhooks have no member behind them, so hold no roles.
+func (c *memberRolesCache) HasAnyRole(message discord.Message, roleIDs []discord.RoleID) (bool, error) {
+	if message.WebhookID.IsValid() {
+		return false, nil
+	}
+
+	held, err := c.Roles(message.Author.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, heldID := range held {
+		for _, roleID := range roleIDs {
+			if heldID == roleID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// keepRules builds the rules that decide which messages in a channel are kept from
+// being reaped, from the channel's config, looking up the roles of messages' authors
+// with members.
+func (b *Bot) keepRules(channelConfig ChannelConfig, members *memberRolesCache) ([]keepRule, error) {
+	keep := channelConfig.Keep
+
+	rules := []keepRule{
+		{"pinned", func(message discord.Message) bool { return message.Pinned }},
+	}
+
+	// pickers are kept however old they are, or members would have nothing to pick from
+	if pickers := pickerMessageIDs(); len(pickers) > 0 {
+		rules = append(rules, keepRule{"pickers", func(message discord.Message) bool {
+			return pickers[message.ID]
+		}})
+	}
+
+	if len(keep.Reactions) > 0 {
+		rules = append(rules, keepRule{"reacted to", func(message discord.Message) bool {
+			for _, reaction := range message.Reactions {
+				for _, emoji := range keep.Reactions {
+					if reaction.Emoji.Name == emoji || reaction.Emoji.ID.IsValid() && reaction.Emoji.ID.String() == emoji {
+						return true
+					}
+				}
+			}
+			return false
+		}})
+	}
+
+	if keep.Self {
+		me, err := b.State.Me()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, keepRule{"by the bot", func(message discord.Message) bool {
+			return message.Author.ID == me.ID
+		}})
+	}
+
+	if keep.Attachments {
+		rules = append(rules, keepRule{"with attachments", func(message discord.Message) bool {
+			return len(message.Attachments) > 0
+		}})
+	}
+
+	if len(keep.Roles) > 0 || len(channelConfig.OnlyRoles) > 0 {
+		// rules about roles come last, so authors are only looked up when nothing else keeps
+		// their messages - and they can't say whether to keep a message if its author's roles
+		// can't be looked up, so it's kept until they can be
+		rules = append(rules, keepRule{"by a member whose roles couldn't be looked up", func(message discord.Message) bool {
+			_, err := members.HasAnyRole(message, nil)
+			return err != nil
+		}})
+	}
+
+	if len(keep.Roles) > 0 {
+		rules = append(rules, keepRule{"by a kept role", func(message discord.Message) bool {
+			kept, _ := members.HasAnyRole(message, keep.Roles)
+			return kept
+		}})
+	}
+
+	if len(channelConfig.OnlyRoles) > 0 {
+		rules = append(rules, keepRule{"not by a reaped role", func(message discord.Message) bool {
+			reaped, _ := members.HasAnyRole(message, channelConfig.OnlyRoles)
+			return !reaped
+		}})
+	}
+
+	return rules, nil
+}
+
+// keptBy returns the first of the rules that keeps a message, or nil if none of them do.
+func keptBy(rules []keepRule, message discord.Message) *keepRule {
+	for i := range rules {
+		if rules[i].Keeps(message) {
+			return &rules[i]
+		}
+	}
+	return nil
+}
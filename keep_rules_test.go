@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/state"
+)
+
+func TestKeptBy(t *testing.T) {
+	bot := &Bot{State: state.New("Bot test")}
+	if err := bot.State.Cabinet.MyselfSet(discord.User{ID: 99}, false); err != nil {
+		t.Fatal(err)
+	}
+
+	pickerMessagesMutex.Lock()
+	previousPickers := pickerMessages
+	pickerMessages = []PickerMessage{{GuildID: 1, ChannelID: 2, MessageID: 3, Kind: ColourPicker}}
+	pickerMessagesMutex.Unlock()
+	t.Cleanup(func() {
+		pickerMessagesMutex.Lock()
+		pickerMessages = previousPickers
+		pickerMessagesMutex.Unlock()
+	})
+
+	members := newMemberRolesCache(bot, 1)
+	members.roles[10] = []discord.RoleID{100}
+	members.roles[11] = []discord.RoleID{101}
+	members.roles[12] = nil
+	members.failed[13] = errors.New("Discord is down")
+
+	rules, err := bot.keepRules(ChannelConfig{
+		Keep: KeepRules{
+			Reactions:   []string{"📌", "123"},
+			Roles:       []discord.RoleID{100},
+			Self:        true,
+			Attachments: true,
+		},
+		OnlyRoles: []discord.RoleID{101},
+	}, members)
+	if err != nil {
+		t.Fatalf("keepRules failed with error %v", err)
+	}
+
+	byReaped := discord.User{ID: 11}
+	tests := []struct {
+		name    string
+		message discord.Message
+		want    string
+	}{
+		{"reaped", discord.Message{Author: byReaped}, ""},
+		{"pinned", discord.Message{Author: byReaped, Pinned: true}, "pinned"},
+		{"picker", discord.Message{ID: 3, Author: discord.User{ID: 99}}, "pickers"},
+		{"unicode reaction", discord.Message{Author: byReaped, Reactions: []discord.Reaction{{Emoji: discord.Emoji{Name: "📌"}}}}, "reacted to"},
+		{"custom reaction", discord.Message{Author: byReaped, Reactions: []discord.Reaction{{Emoji: discord.Emoji{ID: 123, Name: "keep"}}}}, "reacted to"},
+		{"other reaction", discord.Message{Author: byReaped, Reactions: []discord.Reaction{{Emoji: discord.Emoji{Name: "👍"}}}}, ""},
+		{"kept role", discord.Message{Author: discord.User{ID: 10}}, "by a kept role"},
+		{"by the bot", discord.Message{Author: discord.User{ID: 99}}, "by the bot"},
+		{"attachment", discord.Message{Author: byReaped, Attachments: []discord.Attachment{{Filename: "a.png"}}}, "with attachments"},
+		{"not by a reaped role", discord.Message{Author: discord.User{ID: 12}}, "not by a reaped role"},
+		{"by a webhook", discord.Message{Author: discord.User{ID: 13}, WebhookID: 14}, "not by a reaped role"},
+		{"member who couldn't be looked up", discord.Message{Author: discord.User{ID: 13}}, "by a member whose roles couldn't be looked up"},
+		{"first rule wins", discord.Message{Author: discord.User{ID: 10}, Pinned: true}, "pinned"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ""
+			if rule := keptBy(rules, test.message); rule != nil {
+				got = rule.Name
+			}
+			if got != test.want {
+				t.Errorf("keptBy = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -2,124 +2,320 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 
-	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
-	"github.com/diamondburned/arikawa/v3/state"
 )
 
-// Configuration and flags are set up in config.go!
+// The command line is set up in cli.go!
 
 func main() {
-	var token = os.Getenv("BOT_TOKEN")
-	if token == "" {
-		log.Fatalln("No $BOT_TOKEN given.")
+	if err := runCLI(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatalln(err)
+	}
+}
+
+// runServe connects to Discord and runs the bot until it's stopped.
+func runServe(args []string) error {
+	flags, options := newFlagSet("serve")
+	devGuild := flags.String("dev-guild", "", "Registers commands to just the guild with this ID, so changes to them show up instantly.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
 	}
 
 	appID, err := discord.ParseSnowflake(os.Getenv("APP_ID"))
 	if err != nil {
-		log.Fatalf("Invalid snowflake for $APP_ID: %v", err)
+		return fmt.Errorf("invalid snowflake for $APP_ID: %w", err)
 	}
 
-	s := state.New("Bot " + token)
+	bot, err := newBot()
 	if err != nil {
-		log.Fatalln("Session failed:", err)
+		return err
 	}
 
-	bot := Bot{State: s}
+	if err := loadPickerMessages(); err != nil {
+		return fmt.Errorf("failed loading picker messages: %w", err)
+	}
 
-	switch {
-	case reaperMode:
-		log.Println("Reaper mode active")
+	if err := loadRoleExpiries(); err != nil {
+		return fmt.Errorf("failed loading role expiries: %w", err)
+	}
 
-		for guildID, guildConfig := range config.Guilds {
-			for channelID, channelConfig := range guildConfig.Channels {
-				log.Println("Reaping channel", channelID, "from guild", guildID)
-				err = bot.ReapChannelMessages(discord.ChannelID(channelID), channelConfig.ReapDuration)
-				if err != nil {
-					log.Fatalln("Failed reaping channel", channelID, "from guild", guildID, "with error", err)
-				}
-			}
-		}
+	if err := loadCustomColourRoles(); err != nil {
+		return fmt.Errorf("failed loading custom colour roles: %w", err)
+	}
 
-		log.Println("Reaping done, ending")
-	case warnInvalidMode:
-		log.Println("Invalid user warning mode active")
-		if warnInvalidDryRunMode {
-			log.Println("Dry run active - no real messages will be sent!")
-		}
+	if err := loadCreatedRoles(); err != nil {
+		return fmt.Errorf("failed loading created roles: %w", err)
+	}
+
+	if err := loadJobHistory(); err != nil {
+		return fmt.Errorf("failed loading job history: %w", err)
+	}
 
-		for guildID, guildConfig := range config.Guilds {
-			// For now, we ignore alumni guilds in here
-			if guildConfig.AlumniGuild {
-				continue
-			}
+	dispatcher := Dispatcher{Bot: *bot}
 
-			bot.warnInvalidUsers(guildID)
+	s := bot.State
+	s.AddHandler(dispatcher.InteractionEventDispatcher)
+	s.AddHandler(dispatcher.NewGuildMemberEventDispatcher)
+	s.AddHandler(dispatcher.GuildMemberRemoveEventDispatcher)
+
+	var devGuildID discord.GuildID
+	if *devGuild != "" {
+		devGuildSnowflake, err := discord.ParseSnowflake(*devGuild)
+		if err != nil {
+			return fmt.Errorf("invalid snowflake for --dev-guild: %w", err)
 		}
+		devGuildID = discord.GuildID(devGuildSnowflake)
+	}
+
+	if err := bot.SyncCommands(discord.AppID(appID), devGuildID); err != nil {
+		return fmt.Errorf("failed to sync commands: %w", err)
+	}
+
+	s.AddIntents(gateway.IntentGuildMessages)
+	s.AddIntents(gateway.IntentGuildMembers)
+	s.AddIntents(gateway.IntentGuildInvites)
+	s.AddIntents(gateway.IntentDirectMessages)
+
+	if err := s.Open(context.Background()); err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer s.Close()
+
+	log.Println("Bot started")
+
+	// Bring any pickers posted under an older config up to date.
+	refreshed, err := bot.RefreshPickers(discord.NullGuildID)
+	if err != nil {
+		log.Println("Failed refreshing some picker messages:", err)
+	}
+	log.Println("Refreshed", refreshed, "picker messages")
+
+	go bot.RunScheduler()
+	go bot.WatchConfig()
 
-		log.Println("Invalid user warning done, ending")
-	case purgeInvalidMode:
-		log.Println("Invalid user purging mode active")
+	// Block forever.
+	select {}
+}
+
+// runReap deletes old messages from the channels configured to be reaped.
+func runReap(args []string) error {
+	flags, options := newFlagSet("reap")
+	var guildIDs, channelIDs snowflakeListFlag
+	flags.Var(&guildIDs, "guild", "Only reaps channels in the guild with this ID. Can be given more than once.")
+	flags.Var(&channelIDs, "channel", "Only reaps the channel with this ID. Can be given more than once.")
+	dryRun := flags.Bool("dry-run", false, "Logs what would be deleted, without deleting anything.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
+	}
+
+	bot, err := newBot()
+	if err != nil {
+		return err
+	}
+
+	// pickers are never reaped, so the reaper needs to know where they are
+	if err := loadPickerMessages(); err != nil {
+		return fmt.Errorf("failed loading picker messages: %w", err)
+	}
+
+	guilds, err := targetGuilds(guildIDs)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Reaper mode active")
 
-		for guildID, guildConfig := range config.Guilds {
-			// For now, we ignore alumni guilds in here
-			if guildConfig.AlumniGuild {
-				continue
-			}
+	failures := 0
+	for _, summary := range bot.ReapConfiguredChannels(guilds, channelIDs, *dryRun) {
+		failures += len(summary.Failures)
+	}
+
+	log.Println("Reaping done, ending")
+	if failures > 0 {
+		return fmt.Errorf("reaping finished with %d failures", failures)
+	}
+	return nil
+}
+
+// runWarn messages members who aren't verified as their guild needs, warning them
+// that they'll be removed.
+func runWarn(args []string) error {
+	flags, options := newFlagSet("warn")
+	var guildIDs snowflakeListFlag
+	flags.Var(&guildIDs, "guild", "Only warns members of the guild with this ID. Can be given more than once.")
+	deadline := flags.String("deadline", "a few days", "When members should expect to be removed, to tell them in the warning.")
+	dryRun := flags.Bool("dry-run", false, "Doesn't message anyone, but just prints the names of members who would be warned.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
+	}
+
+	bot, err := newBot()
+	if err != nil {
+		return err
+	}
+
+	if err := loadWarningText(); err != nil {
+		return err
+	}
 
-			bot.PurgeInvalidUsers(guildID)
+	guilds, err := targetGuilds(guildIDs)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Invalid user warning mode active")
+	if *dryRun {
+		log.Println("Dry run active - no real messages will be sent!")
+	}
+
+	for guildID, guildConfig := range guilds {
+		// For now, we ignore alumni guilds in here
+		if guildConfig.AlumniGuild {
+			continue
 		}
 
-		log.Println("Invalid user purging done, ending")
-	default:
-		dispatcher := Dispatcher{Bot: bot}
-
-		s.AddHandler(dispatcher.InteractionEventDispatcher)
-		s.AddHandler(dispatcher.NewGuildMemberEventDispatcher)
-
-		newCommands := []api.CreateCommandData{
-			{
-				Name:        "verification_button",
-				Description: "Inserts a verification button in the current channel - for server owners only!",
-			},
-			{
-				Name:        "pronoun_picker",
-				Description: "Inserts a pronoun picker in the current channel - for server owners only!",
-			},
-			{
-				Name:        "colour_picker",
-				Description: "Inserts a colour picker in the current channel - for server owners only!",
-			},
-			{
-				Name:        "role_picker",
-				Description: "Inserts a general role picker in the current channel - for server owners only!",
-			},
+		if _, err := bot.warnInvalidUsers(guildID, *deadline, *dryRun); err != nil {
+			return err
 		}
+	}
 
-		for _, command := range newCommands {
-			_, err := s.CreateCommand(discord.AppID(appID), command)
-			if err != nil {
-				log.Fatalln("failed to create command:", err)
-			}
+	log.Println("Invalid user warning done, ending")
+	return nil
+}
+
+// runPurge removes members who aren't verified as their guild needs.
+func runPurge(args []string) error {
+	flags, options := newFlagSet("purge")
+	var guildIDs snowflakeListFlag
+	flags.Var(&guildIDs, "guild", "Only removes members of the guild with this ID. Can be given more than once.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
+	}
+
+	bot, err := newBot()
+	if err != nil {
+		return err
+	}
+
+	guilds, err := targetGuilds(guildIDs)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Invalid user purging mode active")
+
+	for guildID, guildConfig := range guilds {
+		// For now, we ignore alumni guilds in here
+		if guildConfig.AlumniGuild {
+			continue
+		}
+
+		if err := bot.PurgeInvalidUsers(guildID); err != nil {
+			return err
 		}
+	}
+
+	log.Println("Invalid user purging done, ending")
+	return nil
+}
 
-		s.AddIntents(gateway.IntentGuildMessages)
-		s.AddIntents(gateway.IntentGuildMembers)
-		s.AddIntents(gateway.IntentGuildInvites)
-		s.AddIntents(gateway.IntentDirectMessages)
+// runReport lists members who aren't verified as their guild needs, without messaging them.
+func runReport(args []string) error {
+	flags, options := newFlagSet("report")
+	var guildIDs snowflakeListFlag
+	flags.Var(&guildIDs, "guild", "Only lists members of the guild with this ID. Can be given more than once.")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
+	}
 
-		if err := s.Open(context.Background()); err != nil {
-			log.Fatalln("Failed to connect:", err)
+	bot, err := newBot()
+	if err != nil {
+		return err
+	}
+
+	guilds, err := targetGuilds(guildIDs)
+	if err != nil {
+		return err
+	}
+
+	for guildID := range guilds {
+		if err := bot.reportInvalidUsers(guildID); err != nil {
+			return err
 		}
-		defer s.Close()
+	}
+	return nil
+}
+
+// runGarbageRoles lists the roles the bot created, and deletes empty ones that aren't in the config.
+func runGarbageRoles(args []string) error {
+	flags, options := newFlagSet("gc-roles")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.load(); err != nil {
+		return err
+	}
+
+	bot, err := newBot()
+	if err != nil {
+		return err
+	}
+
+	log.Println("Role garbage collection mode active")
+
+	if err := loadCreatedRoles(); err != nil {
+		return fmt.Errorf("failed loading created roles: %w", err)
+	}
+
+	if err := loadCustomColourRoles(); err != nil {
+		return fmt.Errorf("failed loading custom colour roles: %w", err)
+	}
+
+	bot.CollectGarbageRoles()
+
+	log.Println("Role garbage collection done, ending")
+	return nil
+}
 
-		log.Println("Bot started")
+// runCheckConfig checks the config file for problems. The config is loaded by the check
+// itself, rather than beforehand, so that problems with it can be reported properly.
+func runCheckConfig(args []string) error {
+	flags, options := newFlagSet("check-config")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if err := options.loadEnv(); err != nil {
+		return err
+	}
 
-		// Block forever.
-		select {}
+	configPath = options.ConfigPath
+	if !checkConfig(configPath, os.Getenv("BOT_TOKEN")) {
+		return errors.New("the config has problems")
 	}
+	return nil
 }
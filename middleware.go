@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// somethingWentWrongMessage is shown to a member when handling their interaction fails.
+const somethingWentWrongMessage = "Sorry, something went wrong there 😵 Please try again in a bit, or let a committee member know if it keeps happening."
+
+// InteractionHandler handles an interaction, returning any error it ran into.
+type InteractionHandler func(e *gateway.InteractionCreateEvent) error
+
+// InteractionMiddleware wraps an InteractionHandler to add behaviour around it.
+type InteractionMiddleware func(next InteractionHandler) InteractionHandler
+
+// EventHandler handles a gateway event, returning any error it ran into.
+type EventHandler func(event interface{}) error
+
+// EventMiddleware wraps an EventHandler to add behaviour around it.
+type EventMiddleware func(next EventHandler) EventHandler
+
+// chainInteractionMiddleware wraps a handler in each of the middlewares given, with
+// the first middleware being the outermost.
+func chainInteractionMiddleware(handler InteractionHandler, middlewares ...InteractionMiddleware) InteractionHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// chainEventMiddleware wraps a handler in each of the middlewares given, with the
+// first middleware being the outermost.
+func chainEventMiddleware(handler EventHandler, middlewares ...EventMiddleware) EventHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// recoverInteractionPanics turns a panic in an interaction handler into an error,
+// so one bad interaction can't bring the whole bot down.
+func recoverInteractionPanics(next InteractionHandler) InteractionHandler {
+	return func(e *gateway.InteractionCreateEvent) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Recovered from panic handling interaction %s: %v\n%s", e.ID, recovered, debug.Stack())
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+
+		return next(e)
+	}
+}
+
+// logInteractions logs every interaction, along with who sent it, where, what it
+// was for, how long it took to handle and whether it failed.
+func logInteractions(next InteractionHandler) InteractionHandler {
+	return func(e *gateway.InteractionCreateEvent) error {
+		start := time.Now()
+		err := next(e)
+
+		var userID discord.UserID
+		if sender := e.Sender(); sender != nil {
+			userID = sender.ID
+		}
+
+		kind, name := describeInteraction(e)
+		if err != nil {
+			log.Printf("interaction=%s type=%s name=%q user=%s guild=%s took=%s error=%q", e.ID, kind, name, userID, e.GuildID, time.Since(start), err)
+		} else {
+			log.Printf("interaction=%s type=%s name=%q user=%s guild=%s took=%s", e.ID, kind, name, userID, e.GuildID, time.Since(start))
+		}
+
+		return err
+	}
+}
+
+// respondOnInteractionError makes sure a member always hears back when handling their
+// interaction fails, rather than being left with Discord's "This interaction failed".
+func (bot *Bot) respondOnInteractionError(next InteractionHandler) InteractionHandler {
+	return func(e *gateway.InteractionCreateEvent) error {
+		err := next(e)
+		if err == nil {
+			return nil
+		}
+
+		// autocomplete interactions can only be answered with suggestions
+		if _, isAutocomplete := e.Data.(*discord.AutocompleteInteraction); isAutocomplete {
+			return err
+		}
+
+		// the responder takes care of following up if we'd already responded before the error
+		if respondErr := bot.respondEphemerally(e, somethingWentWrongMessage); respondErr != nil {
+			log.Println("Failed telling user about failed interaction", e.ID, "with error", respondErr)
+		}
+
+		return err
+	}
+}
+
+// describeInteraction returns the type of an interaction, and the name of the
+// command or custom ID of the component it's for.
+func describeInteraction(e *gateway.InteractionCreateEvent) (string, string) {
+	switch data := e.Data.(type) {
+	case *discord.CommandInteraction:
+		return "command", data.Name
+	case *discord.AutocompleteInteraction:
+		return "autocomplete", data.Name
+	case *discord.ButtonInteraction:
+		return "button", string(data.CustomID)
+	case *discord.SelectInteraction:
+		return "select", string(data.CustomID)
+	case *discord.ModalInteraction:
+		return "modal", string(data.CustomID)
+	default:
+		return fmt.Sprintf("%T", data), ""
+	}
+}
+
+// recoverEventPanics turns a panic in a gateway event handler into an error.
+func recoverEventPanics(next EventHandler) EventHandler {
+	return func(event interface{}) (err error) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				log.Printf("Recovered from panic handling %T: %v\n%s", event, recovered, debug.Stack())
+				err = fmt.Errorf("panic: %v", recovered)
+			}
+		}()
+
+		return next(event)
+	}
+}
+
+// logEventErrors logs gateway events whose handlers fail, along with how long they took.
+func logEventErrors(next EventHandler) EventHandler {
+	return func(event interface{}) error {
+		start := time.Now()
+		err := next(event)
+		if err != nil {
+			log.Printf("event=%T took=%s error=%q", event, time.Since(start), err)
+		}
+		return err
+	}
+}
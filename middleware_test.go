@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func TestChainInteractionMiddleware(t *testing.T) {
+	calls := []string{}
+	// record makes a middleware that notes when it's entered and left
+	record := func(name string) InteractionMiddleware {
+		return func(next InteractionHandler) InteractionHandler {
+			return func(e *gateway.InteractionCreateEvent) error {
+				calls = append(calls, name+" in")
+				err := next(e)
+				calls = append(calls, name+" out")
+				return err
+			}
+		}
+	}
+
+	handlerErr := errors.New("handler failed")
+	handler := chainInteractionMiddleware(func(e *gateway.InteractionCreateEvent) error {
+		calls = append(calls, "handler")
+		return handlerErr
+	}, record("first"), record("second"))
+
+	if err := handler(&gateway.InteractionCreateEvent{}); err != handlerErr {
+		t.Errorf("handler returned error %v, want %v", err, handlerErr)
+	}
+	want := []string{"first in", "second in", "handler", "second out", "first out"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+}
+
+func TestChainEventMiddleware(t *testing.T) {
+	calls := []string{}
+	record := func(name string) EventMiddleware {
+		return func(next EventHandler) EventHandler {
+			return func(event interface{}) error {
+				calls = append(calls, name)
+				return next(event)
+			}
+		}
+	}
+
+	handler := chainEventMiddleware(func(event interface{}) error {
+		calls = append(calls, "handler")
+		return nil
+	}, record("first"), record("second"), record("third"))
+
+	if err := handler(nil); err != nil {
+		t.Errorf("handler failed with error %v", err)
+	}
+	if want := []string{"first", "second", "third", "handler"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	if err := chainEventMiddleware(func(event interface{}) error { return nil })(nil); err != nil {
+		t.Errorf("handler without middleware failed with error %v", err)
+	}
+}
+
+func TestRecoverPanics(t *testing.T) {
+	interactionHandler := recoverInteractionPanics(func(e *gateway.InteractionCreateEvent) error {
+		panic("interaction went wrong")
+	})
+	if err := interactionHandler(&gateway.InteractionCreateEvent{}); err == nil || !strings.Contains(err.Error(), "interaction went wrong") {
+		t.Errorf("recoverInteractionPanics returned error %v, want the panic", err)
+	}
+
+	eventHandler := recoverEventPanics(func(event interface{}) error {
+		panic("event went wrong")
+	})
+	if err := eventHandler(nil); err == nil || !strings.Contains(err.Error(), "event went wrong") {
+		t.Errorf("recoverEventPanics returned error %v, want the panic", err)
+	}
+}
+
+func TestDescribeInteraction(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     discord.InteractionData
+		wantKind string
+		wantName string
+	}{
+		{"command", &discord.CommandInteraction{Name: "setup"}, "command", "setup"},
+		{"autocomplete", &discord.AutocompleteInteraction{Name: "picker"}, "autocomplete", "picker"},
+		{"button", &discord.ButtonInteraction{CustomID: "v1:verify"}, "button", "v1:verify"},
+		{"select", &discord.SelectInteraction{CustomID: "v1:setup:roles"}, "select", "v1:setup:roles"},
+		{"modal", &discord.ModalInteraction{CustomID: "v1:colour"}, "modal", "v1:colour"},
+		{"ping", &discord.PingInteraction{}, "*discord.PingInteraction", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := &gateway.InteractionCreateEvent{InteractionEvent: discord.InteractionEvent{Data: test.data}}
+			if kind, name := describeInteraction(e); kind != test.wantKind || name != test.wantName {
+				t.Errorf("describeInteraction = %q, %q, want %q, %q", kind, name, test.wantKind, test.wantName)
+			}
+		})
+	}
+}
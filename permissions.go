@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// Capability is something a command lets a member do, which guilds can grant to
+// committee members by role or by Discord permission.
+type Capability string
+
+const (
+	// CapabilityPickers allows posting and refreshing pickers and verification buttons.
+	CapabilityPickers Capability = "pickers"
+	// CapabilityRoles allows handing out roles to other members.
+	CapabilityRoles Capability = "roles"
+	// CapabilityMaintenance allows running maintenance tasks, like cleaning up roles.
+	CapabilityMaintenance Capability = "maintenance"
+	// CapabilityVerification allows checking members' verification, and verifying them by hand.
+	CapabilityVerification Capability = "verification"
+	// CapabilitySetup allows changing how the bot is set up for the guild.
+	CapabilitySetup Capability = "setup"
+	// CapabilityReport allows reporting messages to committee. Everyone holds it by default.
+	CapabilityReport Capability = "report"
+)
+
+// capabilityDefaultPermissions are the Discord permissions that grant each capability
+// when a guild hasn't configured it. They're also used as the default member
+// permissions when registering commands, so members without them can't see the
+// commands at all unless the server's integration settings say otherwise.
+var capabilityDefaultPermissions = map[Capability]discord.Permissions{
+	CapabilityPickers:      discord.PermissionManageGuild,
+	CapabilityRoles:        discord.PermissionManageRoles,
+	CapabilityMaintenance:  discord.PermissionManageGuild,
+	CapabilityVerification: discord.PermissionManageRoles,
+	CapabilitySetup:        discord.PermissionManageGuild,
+	CapabilityReport:       0,
+}
+
+// permissionNames maps the names Discord permissions can be given as in the config file to the permissions.
+var permissionNames = map[string]discord.Permissions{
+	"administrator":   discord.PermissionAdministrator,
+	"manageGuild":     discord.PermissionManageGuild,
+	"manageRoles":     discord.PermissionManageRoles,
+	"manageChannels":  discord.PermissionManageChannels,
+	"manageMessages":  discord.PermissionManageMessages,
+	"manageNicknames": discord.PermissionManageNicknames,
+	"kickMembers":     discord.PermissionKickMembers,
+	"banMembers":      discord.PermissionBanMembers,
+	"moderateMembers": discord.PermissionModerateMembers,
+	"viewAuditLog":    discord.PermissionViewAuditLog,
+}
+
+// CapabilityGrant says which members of a guild hold a capability - those with any
+// of the roles, or any of the Discord permissions, listed.
+type CapabilityGrant struct {
+	Roles       []discord.RoleID `yaml:"roles" json:"roles,omitempty"`
+	Permissions []string         `yaml:"permissions" json:"permissions,omitempty"`
+}
+
+// memberHasCapability checks whether a member of a guild holds a capability, either
+// from the guild's configured grants, or its default permissions if there are none.
+// The server owner and administrators always hold every capability.
+func (bot *Bot) memberHasCapability(guild discord.Guild, member discord.Member, capability Capability) (bool, error) {
+	defaultPermissions, known := capabilityDefaultPermissions[capability]
+	if !known {
+		return false, fmt.Errorf("unknown capability %q", capability)
+	}
+
+	if guild.OwnerID == member.User.ID {
+		return true, nil
+	}
+
+	memberPermissions, err := bot.memberGuildPermissions(guild.ID, member)
+	if err != nil {
+		return false, err
+	}
+
+	if memberPermissions.Has(discord.PermissionAdministrator) {
+		return true, nil
+	}
+
+	grant, configured := currentConfig().Guilds[guild.ID].Permissions[capability]
+	if !configured {
+		return memberPermissions.Has(defaultPermissions), nil
+	}
+
+	for _, roleID := range grant.Roles {
+		if memberHasRole(&member, roleID) {
+			return true, nil
+		}
+	}
+
+	for _, permissionName := range grant.Permissions {
+		permission, ok := permissionNames[permissionName]
+		if !ok {
+			return false, fmt.Errorf("unknown permission %q granting %s in guild %s", permissionName, capability, guild.ID)
+		}
+
+		if memberPermissions.Has(permission) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// memberGuildPermissions works out a member's server-wide permissions from their roles.
+func (bot *Bot) memberGuildPermissions(guildID discord.GuildID, member discord.Member) (discord.Permissions, error) {
+	roles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return 0, err
+	}
+
+	var permissions discord.Permissions
+	for _, role := range roles {
+		// the @everyone role shares its ID with the guild
+		if discord.Snowflake(role.ID) == discord.Snowflake(guildID) || memberHasRole(&member, role.ID) {
+			permissions |= role.Permissions
+		}
+	}
+
+	return permissions, nil
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/state/store"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// pickerMessagesFile is the data file that every posted picker message is recorded in.
+const pickerMessagesFile = "pickers.json"
+
+// PickerKind identifies what sort of picker a message holds.
+type PickerKind string
+
+const (
+	VerificationPicker PickerKind = "verification"
+	PronounPicker      PickerKind = "pronoun"
+	ColourPicker       PickerKind = "colour"
+	RolePicker         PickerKind = "role"
+)
+
+// errUnknownPickerKind is returned when asked to build a picker of a kind that doesn't exist.
+var errUnknownPickerKind = errors.New("unknown picker kind")
+
+// errUnknownRoleGroup is returned when asked to build a role picker for a group that isn't in the config.
+var errUnknownRoleGroup = errors.New("unknown role group")
+
+// PickerMessage records a picker message that the bot has posted, so that it
+// can be found and updated again later.
+type PickerMessage struct {
+	GuildID   discord.GuildID   `json:"guildID"`
+	ChannelID discord.ChannelID `json:"channelID"`
+	MessageID discord.MessageID `json:"messageID"`
+	Kind      PickerKind        `json:"kind"`
+	// Group is the role group a role picker offers, or empty for the guild's main list of roles.
+	Group string `json:"group,omitempty"`
+	// Role, if set, is the only role the picker offers.
+	Role string `json:"role,omitempty"`
+	// Title, if set, replaces the picker's usual text.
+	Title string `json:"title,omitempty"`
+}
+
+// pickerMessages holds every picker message the bot knows about, guarded by pickerMessagesMutex.
+var pickerMessages []PickerMessage
+var pickerMessagesMutex sync.Mutex
+
+// loadPickerMessages reads the recorded picker messages in from the data directory.
+func loadPickerMessages() error {
+	pickerMessagesMutex.Lock()
+	defer pickerMessagesMutex.Unlock()
+
+	return loadJSON(pickerMessagesFile, &pickerMessages)
+}
+
+// pickerMessageIDs returns the IDs of every picker message the bot has posted.
+func pickerMessageIDs() map[discord.MessageID]bool {
+	pickerMessagesMutex.Lock()
+	defer pickerMessagesMutex.Unlock()
+
+	ids := make(map[discord.MessageID]bool, len(pickerMessages))
+	for _, picker := range pickerMessages {
+		ids[picker.MessageID] = true
+	}
+	return ids
+}
+
+// pickerRoleNames returns the names of the roles offered by a picker of the given kind,
+// from the current configuration for the guild. Role pickers offer the roles in the
+// named group, or the guild's main list of roles if the group's empty.
+func pickerRoleNames(kind PickerKind, guildID discord.GuildID, group string) ([]string, error) {
+	switch kind {
+	case VerificationPicker:
+		return nil, nil
+	case PronounPicker:
+		return currentConfig().GuildPronouns(guildID), nil
+	case ColourPicker:
+		return currentConfig().Guilds[guildID].Colours, nil
+	case RolePicker:
+		roles, ok := currentConfig().Guilds[guildID].RoleGroup(group)
+		if !ok {
+			return nil, fmt.Errorf("%w %q", errUnknownRoleGroup, group)
+		}
+		return RoleNames(roles), nil
+	default:
+		return nil, fmt.Errorf("%w %q", errUnknownPickerKind, kind)
+	}
+}
+
+// pickerMessageContent builds the text and buttons for a picker, from the current
+// configuration for its guild. If the picker is just for one role, only that role's
+// button is included, and if it has a title, that's used in place of the usual text.
+func (bot *Bot) pickerMessageContent(picker PickerMessage) (string, discord.ContainerComponents, error) {
+	roleNames, err := pickerRoleNames(picker.Kind, picker.GuildID, picker.Group)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if picker.Role != "" {
+		var onlyRole []string
+		for _, name := range roleNames {
+			if strings.EqualFold(name, picker.Role) {
+				onlyRole = append(onlyRole, name)
+			}
+		}
+		roleNames = onlyRole
+	}
+
+	var content string
+	var components discord.ContainerComponents
+	switch picker.Kind {
+	case VerificationPicker:
+		content = "Ready to get verified? Click here to start the process..."
+		components = discord.ContainerComponents{
+			&discord.ActionRowComponent{
+				&discord.ButtonComponent{
+					CustomID: CustomID{Type: VerifyButtonID}.Encode(),
+					Label:    "Let's get verified!",
+					Emoji: &discord.ComponentEmoji{
+						Name: "🎉",
+					},
+					Style: discord.PrimaryButtonStyle(),
+				},
+			},
+		}
+	case PronounPicker:
+		content = "👋 What pronouns do you use?"
+		components, err = bot.pickerButtons(picker.Kind, picker.GuildID, roleNames)
+	case ColourPicker:
+		content = "🎨 Pick a colour for your username!"
+		components, err = bot.pickerButtons(picker.Kind, picker.GuildID, roleNames)
+		if err == nil && picker.Role == "" && currentConfig().Guilds[picker.GuildID].CustomColours {
+			components = append(components, customColourButtonRow())
+		}
+	case RolePicker:
+		content = "📋 Collect any extra roles you'd like."
+		components, err = bot.pickerButtons(picker.Kind, picker.GuildID, roleNames)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	if picker.Title != "" {
+		content = picker.Title
+	}
+
+	return content, components, nil
+}
+
+// pickerButtons builds the buttons for a picker offering the roles named. Each button
+// holds the ID of its role, or its name if it doesn't exist yet - roles are only created
+// when they're first picked.
+func (bot *Bot) pickerButtons(kind PickerKind, guildID discord.GuildID, roleNames []string) (discord.ContainerComponents, error) {
+	guildRoles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't fetch the roles for the %s picker: %w", kind, err)
+	}
+
+	existing := map[string]discord.RoleID{}
+	for _, role := range guildRoles {
+		existing[strings.ToLower(role.Name)] = role.ID
+	}
+
+	customIDs := make([]discord.ComponentID, len(roleNames))
+	for i, name := range roleNames {
+		if roleID, ok := existing[strings.ToLower(name)]; ok {
+			customIDs[i] = CustomID{Type: PickerButtonID, Picker: kind, RoleID: roleID}.Encode()
+		} else {
+			customIDs[i] = CustomID{Type: PickerRoleNameButtonID, Picker: kind, RoleName: name}.Encode()
+		}
+	}
+
+	return generateButtonComponents(roleNames, customIDs), nil
+}
+
+// postPicker responds to a command interaction with a picker, and records the message
+// it posted so that it can be refreshed later on. The picker's guild, channel and
+// message are filled in from the interaction.
+func (bot *Bot) postPicker(e *gateway.InteractionCreateEvent, picker PickerMessage) error {
+	kind := picker.Kind
+	picker.GuildID = e.GuildID
+
+	content, components, err := bot.pickerMessageContent(picker)
+	if err != nil {
+		return err
+	}
+
+	if err := bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.MessageInteractionWithSource,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(content),
+			Components: &components,
+		},
+	}); err != nil {
+		log.Printf("failed to send interaction callback in %s picker: %v", kind, err)
+		return err
+	}
+
+	// The response to an interaction doesn't tell us the message it created,
+	// so we need to go and ask for it.
+	message, err := bot.State.InteractionResponse(e.AppID, e.Token)
+	if err != nil {
+		return fmt.Errorf("posted %s picker but couldn't fetch its message to record it: %w", kind, err)
+	}
+
+	pickerMessagesMutex.Lock()
+	defer pickerMessagesMutex.Unlock()
+
+	picker.ChannelID = message.ChannelID
+	picker.MessageID = message.ID
+	pickerMessages = append(pickerMessages, picker)
+
+	return saveJSON(pickerMessagesFile, pickerMessages)
+}
+
+// RefreshPickers edits every recorded picker message in place to match the
+// current configuration. If guildID is valid, only that guild's pickers are
+// refreshed. Pickers whose messages have since been deleted are forgotten.
+// It returns the number of pickers that were refreshed.
+func (bot *Bot) RefreshPickers(guildID discord.GuildID) (int, error) {
+	// the pickers are edited without holding the lock, so that new pickers can be posted and looked up meanwhile
+	pickerMessagesMutex.Lock()
+	pickers := []PickerMessage{}
+	for _, picker := range pickerMessages {
+		if !guildID.IsValid() || picker.GuildID == guildID {
+			pickers = append(pickers, picker)
+		}
+	}
+	pickerMessagesMutex.Unlock()
+
+	refreshed := 0
+	forgotten := map[discord.MessageID]bool{}
+	var lastErr error
+
+	for _, picker := range pickers {
+		content, components, err := bot.pickerMessageContent(picker)
+		if errors.Is(err, errUnknownPickerKind) || errors.Is(err, errUnknownRoleGroup) {
+			log.Println("Dropping picker", picker.MessageID, "in channel", picker.ChannelID, "with error", err)
+			forgotten[picker.MessageID] = true
+			continue
+		} else if err != nil {
+			log.Println("Failed building picker", picker.MessageID, "in channel", picker.ChannelID, "with error", err)
+			lastErr = err
+			continue
+		}
+
+		_, err = bot.State.EditMessageComplex(picker.ChannelID, picker.MessageID, api.EditMessageData{
+			Content:    option.NewNullableString(content),
+			Components: &components,
+		})
+
+		if isNotFound(err) {
+			log.Println("Picker", picker.MessageID, "in channel", picker.ChannelID, "has been deleted - forgetting it")
+			forgotten[picker.MessageID] = true
+			continue
+		}
+
+		// keep hold of pickers that failed for any other reason - it may be temporary
+		if err != nil {
+			log.Println("Failed refreshing picker", picker.MessageID, "in channel", picker.ChannelID, "with error", err)
+			lastErr = err
+			continue
+		}
+
+		refreshed++
+	}
+
+	if len(forgotten) == 0 {
+		return refreshed, lastErr
+	}
+
+	pickerMessagesMutex.Lock()
+	defer pickerMessagesMutex.Unlock()
+
+	remaining := []PickerMessage{}
+	for _, picker := range pickerMessages {
+		if !forgotten[picker.MessageID] {
+			remaining = append(remaining, picker)
+		}
+	}
+	pickerMessages = remaining
+
+	if err := saveJSON(pickerMessagesFile, pickerMessages); err != nil {
+		return refreshed, err
+	}
+
+	return refreshed, lastErr
+}
+
+// OnRefreshPickersCommand is run by the interaction event dispatcher when the command
+// to refresh all of the guild's picker messages is activated.
+func (bot *Bot) OnRefreshPickersCommand(e *gateway.InteractionCreateEvent) error {
+	refreshed, err := bot.RefreshPickers(e.GuildID)
+
+	message := fmt.Sprintf("Refreshed %d picker messages to match the current config ✨", refreshed)
+	if err != nil {
+		message += " Some couldn't be updated, though - check the logs for details."
+	}
+
+	if respondErr := bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.MessageInteractionWithSource,
+		Data: &api.InteractionResponseData{
+			Content: option.NewNullableString(message),
+			Flags:   api.EphemeralResponse,
+		},
+	}); respondErr != nil {
+		log.Println("failed to send interaction callback for refresh pickers interaction:", respondErr)
+		return respondErr
+	}
+
+	return err
+}
+
+// OnPickerButton is run by the interaction event dispatcher when a button on a pronoun,
+// colour or role picker is pressed. It toggles the role the button is for - by its ID if
+// the button holds one, or else by its name, creating it if it doesn't exist yet.
+func (bot *Bot) OnPickerButton(e *gateway.InteractionCreateEvent, id CustomID) error {
+	var role *discord.Role
+	roleName := id.RoleName
+	if id.RoleID.IsValid() {
+		var err error
+		role, err = bot.State.Role(e.GuildID, id.RoleID)
+		if errors.Is(err, store.ErrNotFound) {
+			return bot.respondEphemerally(e, "Sorry, that role isn't available any more 😢")
+		} else if err != nil {
+			return err
+		}
+
+		roleName = role.Name
+	}
+
+	auditLogReason := fmt.Sprintf("requested %s role", id.Picker)
+	if id.Picker == RolePicker {
+		auditLogReason = "requested generic role"
+	}
+
+	return bot.InteractionToggleUserRole(e, e.Member, id.Picker, role, roleName, e.GuildID, auditLogReason)
+}
+
+// OnPickerCreateCommand is run by the interaction event dispatcher when the command to
+// post a picker is activated.
+func (bot *Bot) OnPickerCreateCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	picker := PickerMessage{
+		Kind:  PickerKind(data.Options.Find("kind").String()),
+		Group: data.Options.Find("group").String(),
+		Role:  data.Options.Find("role").String(),
+		Title: data.Options.Find("title").String(),
+	}
+
+	if picker.Group != "" && picker.Kind != RolePicker {
+		return bot.respondEphemerally(e, "Only role pickers can be posted for a group.")
+	}
+
+	roleNames, err := pickerRoleNames(picker.Kind, e.GuildID, picker.Group)
+	if errors.Is(err, errUnknownRoleGroup) {
+		return bot.respondEphemerally(e, fmt.Sprintf("There's no role group called %q in the config.", picker.Group))
+	} else if err != nil {
+		return err
+	}
+
+	if picker.Role != "" {
+		offered := false
+		for _, name := range roleNames {
+			offered = offered || strings.EqualFold(name, picker.Role)
+		}
+
+		if !offered {
+			return bot.respondEphemerally(e, fmt.Sprintf("The %s role isn't offered by %s pickers in the config.", picker.Role, picker.Kind))
+		}
+	}
+
+	return bot.postPicker(e, picker)
+}
+
+// autocompleteRoleGroup suggests the names of the guild's role groups.
+func (bot *Bot) autocompleteRoleGroup(e *gateway.InteractionCreateEvent, options discord.AutocompleteOptions) ([]discord.StringChoice, error) {
+	var groups []string
+	for group := range currentConfig().Guilds[e.GuildID].RoleGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+
+	choices := make([]discord.StringChoice, len(groups))
+	for i, group := range groups {
+		choices[i] = discord.StringChoice{Name: group, Value: group}
+	}
+	return choices, nil
+}
+
+// autocompletePickerRole suggests the names of the roles offered by the kind of picker,
+// and group, chosen so far. Roles that the guild doesn't have yet are marked as such, as
+// they'll be created when they're first picked.
+func (bot *Bot) autocompletePickerRole(e *gateway.InteractionCreateEvent, options discord.AutocompleteOptions) ([]discord.StringChoice, error) {
+	kind := PickerKind(options.Find("kind").String())
+	if kind == "" {
+		kind = RolePicker
+	}
+
+	roleNames, err := pickerRoleNames(kind, e.GuildID, options.Find("group").String())
+	if err != nil {
+		// nothing to suggest until the other options make sense
+		return nil, nil
+	}
+
+	guildRoles, err := bot.State.Roles(e.GuildID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[string]bool{}
+	for _, role := range guildRoles {
+		existing[strings.ToLower(role.Name)] = true
+	}
+
+	choices := make([]discord.StringChoice, len(roleNames))
+	for i, name := range roleNames {
+		label := name
+		if !existing[strings.ToLower(name)] {
+			label += " (not created yet)"
+		}
+		choices[i] = discord.StringChoice{Name: label, Value: name}
+	}
+	return choices, nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// maxPreviewDays is how many days are listed when a preview is posted, so that it fits in
+// a message.
+const maxPreviewDays = 20
+
+// ReapPreview records what the reaper would do in a dry run, without it doing anything.
+type ReapPreview struct {
+	// PerDay counts the messages that would be deleted, by the day they were sent on in UTC.
+	PerDay         map[string]int
+	Oldest, Newest *PreviewedMessage
+	// StaleThreads maps what would be done with stale threads to the threads it would be done to.
+	StaleThreads map[string][]discord.ChannelID
+}
+
+// PreviewedMessage is a message that would be reaped, as described in a preview.
+type PreviewedMessage struct {
+	ID        discord.MessageID
+	ChannelID discord.ChannelID
+	AuthorTag string
+	Timestamp time.Time
+}
+
+// newReapPreview starts a preview of reaping.
+func newReapPreview() *ReapPreview {
+	return &ReapPreview{PerDay: map[string]int{}, StaleThreads: map[string][]discord.ChannelID{}}
+}
+
+// add records messages that would be reaped.
+func (p *ReapPreview) add(messages []discord.Message) {
+	for _, message := range messages {
+		previewed := &PreviewedMessage{
+			ID:        message.ID,
+			ChannelID: message.ChannelID,
+			AuthorTag: message.Author.Tag(),
+			Timestamp: message.Timestamp.Time().UTC(),
+		}
+		p.PerDay[previewed.Timestamp.Format("2006-01-02")]++
+
+		if p.Oldest == nil || previewed.Timestamp.Before(p.Oldest.Timestamp) {
+			p.Oldest = previewed
+		}
+		if p.Newest == nil || previewed.Timestamp.After(p.Newest.Timestamp) {
+			p.Newest = previewed
+		}
+	}
+}
+
+// Total returns how many messages would be deleted.
+func (p *ReapPreview) Total() int {
+	total := 0
+	for _, count := range p.PerDay {
+		total += count
+	}
+	return total
+}
+
+// days returns the days messages would be deleted from, oldest first.
+func (p *ReapPreview) days() []string {
+	days := make([]string, 0, len(p.PerDay))
+	for day := range p.PerDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	return days
+}
+
+// previewMessageLink links to a message that would be reaped.
+func previewMessageLink(guildID discord.GuildID, message *PreviewedMessage) string {
+	return fmt.Sprintf("[%s](https://discord.com/channels/%s/%s/%s) by %s in %s",
+		message.Timestamp.Format("2 Jan 2006 15:04 MST"), guildID, message.ChannelID, message.ID, message.AuthorTag, message.ChannelID.Mention())
+}
+
+// PreviewMessage formats a dry run's summary to show committee what reaping would do.
+func (s *ReapSummary) PreviewMessage() string {
+	p := s.Preview
+	var message strings.Builder
+	fmt.Fprintf(&message, "🔍 Reaping would delete %d messages from %d channels and threads.", p.Total(), s.ChannelsProcessed)
+
+	if p.Total() > 0 {
+		fmt.Fprintf(&message, "\nOldest: %s\nNewest: %s\nBy day (UTC):", previewMessageLink(s.GuildID, p.Oldest), previewMessageLink(s.GuildID, p.Newest))
+		days := p.days()
+		for i, day := range days {
+			if i == maxPreviewDays {
+				fmt.Fprintf(&message, "\n…and %d more days", len(days)-i)
+				break
+			}
+			fmt.Fprintf(&message, "\n- %s: %d", day, p.PerDay[day])
+		}
+	}
+
+	if len(s.Skipped) > 0 {
+		rules := make([]string, 0, len(s.Skipped))
+		for rule, count := range s.Skipped {
+			rules = append(rules, fmt.Sprintf("%d %s", count, rule))
+		}
+		sort.Strings(rules)
+		fmt.Fprintf(&message, "\nWould keep %s.", strings.Join(rules, ", "))
+	}
+	for _, action := range []string{staleThreadsLock, staleThreadsDelete} {
+		threadIDs := p.StaleThreads[action]
+		if len(threadIDs) == 0 {
+			continue
+		}
+		threads := make([]string, len(threadIDs))
+		for i, threadID := range threadIDs {
+			threads[i] = threadID.Mention()
+		}
+		fmt.Fprintf(&message, "\nWould %s %d stale threads: %s", action, len(threads), strings.Join(threads, ", "))
+	}
+	if len(s.Failures) > 0 {
+		fmt.Fprintf(&message, "\n⚠️ %d things couldn't be checked - see the bot's logs.", len(s.Failures))
+	}
+
+	return truncateMessage(message.String())
+}
+
+// logReapPreview logs what a dry run found.
+func logReapPreview(summary *ReapSummary) {
+	p := summary.Preview
+	log.Println("Dry run for guild", summary.GuildID, "- reaping would delete", p.Total(), "messages from", summary.ChannelsProcessed, "channels and threads")
+	if p.Total() > 0 {
+		log.Println("Oldest message", p.Oldest.ID, "by", p.Oldest.AuthorTag, "in channel", p.Oldest.ChannelID, "at", p.Oldest.Timestamp.Format(time.RFC3339))
+		log.Println("Newest message", p.Newest.ID, "by", p.Newest.AuthorTag, "in channel", p.Newest.ChannelID, "at", p.Newest.Timestamp.Format(time.RFC3339))
+	}
+	for _, day := range p.days() {
+		log.Println(day, "-", p.PerDay[day], "messages")
+	}
+	for rule, count := range summary.Skipped {
+		log.Println("Would keep", count, "messages", rule)
+	}
+	for action, threadIDs := range p.StaleThreads {
+		log.Println("Would", action, len(threadIDs), "stale threads:", threadIDs)
+	}
+}
+
+// OnReaperPreviewCommand is run by the interaction event dispatcher when the command to
+// preview reaping a channel is activated. It shows what reaping the channel would delete,
+// with its configured reap duration or the one given, without deleting anything.
+func (bot *Bot) OnReaperPreviewCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	channelSnowflake, err := data.Options.Find("channel").SnowflakeValue()
+	if err != nil {
+		return err
+	}
+	channelID := discord.ChannelID(channelSnowflake)
+
+	channel, err := bot.State.Channel(channelID)
+	if err != nil {
+		return err
+	}
+
+	// channels can be reaped by their category or the guild's default, as well as by themselves
+	channelConfig, reaped := currentConfig().Guilds[e.GuildID].reapPolicy(*channel)
+	if value := data.Options.Find("duration").String(); value != "" {
+		duration, err := parseDuration(value)
+		if err != nil || duration <= 0 {
+			return bot.respondEphemerally(e, "That doesn't look like a valid duration - try something like 12h, 7d or 2w.")
+		}
+		channelConfig.ReapDuration = Duration(duration)
+	} else if !reaped {
+		return bot.respondEphemerally(e, fmt.Sprintf("%s isn't reaped - give a duration to see what reaping it would delete.", channelID.Mention()))
+	}
+
+	summary := newReapSummary(e.GuildID)
+	summary.Preview = newReapPreview()
+	bot.ReapChannel(e.GuildID, channelID, channelConfig, summary)
+
+	return bot.respondEphemerally(e, summary.PreviewMessage())
+}
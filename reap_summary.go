@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// maxSummaryFailures is how many failures are listed when a summary is posted, so that it
+// fits in a message.
+const maxSummaryFailures = 10
+
+// maxSummaryReasonLength is how many characters of why each failure happened are shown
+// when a summary is posted.
+const maxSummaryReasonLength = 150
+
+// ReapSummary records what the reaper did in a guild in one run.
+type ReapSummary struct {
+	GuildID discord.GuildID
+	// ChannelsProcessed counts the channels and threads that were reaped without failing.
+	ChannelsProcessed int
+	// BulkDeleted counts messages deleted in bulk, and IndividuallyDeleted those too old for
+	// that, which had to be deleted one by one.
+	BulkDeleted, IndividuallyDeleted int
+	// Skipped counts the old messages that were kept, by the name of the rule that kept them.
+	Skipped                       map[string]int
+	ThreadsLocked, ThreadsDeleted int
+	Failures                      []ReapFailure
+	// Preview, if set, makes this a dry run - nothing is changed, and what would have been
+	// deleted is recorded in it.
+	Preview *ReapPreview
+}
+
+// ReapFailure is something the reaper failed to do, which it carried on past.
+type ReapFailure struct {
+	ChannelID discord.ChannelID
+	// MessageID is the message that couldn't be deleted, if the failure was with one message.
+	MessageID discord.MessageID
+	Reason    string
+}
+
+// newReapSummary starts the summary of reaping a guild.
+func newReapSummary(guildID discord.GuildID) *ReapSummary {
+	return &ReapSummary{GuildID: guildID, Skipped: map[string]int{}}
+}
+
+// fail records a failure reaping a channel, or a message in it if messageID is valid, or
+// the whole guild if neither is.
+func (s *ReapSummary) fail(channelID discord.ChannelID, messageID discord.MessageID, err error) {
+	if channelID.IsValid() {
+		log.Println("Reaping failed in channel", channelID, "with error", err)
+	} else {
+		log.Println("Reaping failed in guild", s.GuildID, "with error", err)
+	}
+	s.Failures = append(s.Failures, ReapFailure{ChannelID: channelID, MessageID: messageID, Reason: err.Error()})
+}
+
+// Deleted returns how many messages were deleted altogether.
+func (s *ReapSummary) Deleted() int {
+	return s.BulkDeleted + s.IndividuallyDeleted
+}
+
+// Eventful checks whether anything happened that's worth posting about.
+func (s *ReapSummary) Eventful() bool {
+	return s.Deleted() > 0 || s.ThreadsLocked > 0 || s.ThreadsDeleted > 0 || len(s.Failures) > 0
+}
+
+// String describes the summary in a line, for logs and job history.
+func (s *ReapSummary) String() string {
+	skipped := 0
+	for _, count := range s.Skipped {
+		skipped += count
+	}
+	return fmt.Sprintf("guild %s: reaped %d channels, deleted %d messages (%d in bulk, %d one by one), skipped %d, locked %d threads, deleted %d threads, %d failures",
+		s.GuildID, s.ChannelsProcessed, s.Deleted(), s.BulkDeleted, s.IndividuallyDeleted, skipped, s.ThreadsLocked, s.ThreadsDeleted, len(s.Failures))
+}
+
+// Message formats the summary to be posted to a guild's reaper log channel.
+func (s *ReapSummary) Message() string {
+	var message strings.Builder
+	fmt.Fprintf(&message, "🧹 Reaped %d channels and threads, deleting %d messages - %d in bulk, and %d one by one.",
+		s.ChannelsProcessed, s.Deleted(), s.BulkDeleted, s.IndividuallyDeleted)
+
+	if len(s.Skipped) > 0 {
+		rules := make([]string, 0, len(s.Skipped))
+		for rule, count := range s.Skipped {
+			rules = append(rules, fmt.Sprintf("%d %s", count, rule))
+		}
+		sort.Strings(rules)
+		fmt.Fprintf(&message, "\nKept %s.", strings.Join(rules, ", "))
+	}
+	if s.ThreadsLocked > 0 || s.ThreadsDeleted > 0 {
+		fmt.Fprintf(&message, "\nLocked %d stale threads, and deleted %d.", s.ThreadsLocked, s.ThreadsDeleted)
+	}
+
+	if len(s.Failures) > 0 {
+		fmt.Fprintf(&message, "\n⚠️ %d things failed:", len(s.Failures))
+		for i, failure := range s.Failures {
+			if i == maxSummaryFailures {
+				fmt.Fprintf(&message, "\n…and %d more - see the bot's logs", len(s.Failures)-i)
+				break
+			}
+			reason := failure.Reason
+			if runes := []rune(reason); len(runes) > maxSummaryReasonLength {
+				reason = string(runes[:maxSummaryReasonLength]) + "…"
+			}
+			switch {
+			case failure.MessageID.IsValid():
+				fmt.Fprintf(&message, "\n- message %s in %s: %s", failure.MessageID, failure.ChannelID.Mention(), reason)
+			case failure.ChannelID.IsValid():
+				fmt.Fprintf(&message, "\n- %s: %s", failure.ChannelID.Mention(), reason)
+			default:
+				fmt.Fprintf(&message, "\n- %s", reason)
+			}
+		}
+	}
+	return message.String()
+}
+
+// postReapSummary logs the summary of reaping a guild, and posts it to the guild's reaper
+// log channel if it has one and anything happened. Dry runs are only logged.
+func (b *Bot) postReapSummary(summary *ReapSummary) {
+	if summary.Preview != nil {
+		logReapPreview(summary)
+		return
+	}
+	log.Println("Reaper summary for", summary.String())
+
+	logChannel := currentConfig().Guilds[summary.GuildID].ReaperLogChannel
+	if !logChannel.IsValid() || !summary.Eventful() {
+		return
+	}
+
+	_, err := b.State.SendMessageComplex(logChannel, api.SendMessageData{
+		Content:         truncateMessage(summary.Message()),
+		AllowedMentions: &api.AllowedMentions{},
+	})
+	if err != nil {
+		log.Println("Failed posting the reaper summary to channel", logChannel, "with error", err)
+	}
+}
+
+// rateLimitRetries is how many times the reaper waits out a rate limit on a request before
+// giving up on it - arikawa will already have retried it a few times by then.
+const rateLimitRetries = 3
+
+// withRateLimitRetries makes a request, waiting as long as Discord asks and trying again
+// whenever it's rate limited.
+func withRateLimitRetries(request func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := request()
+		wait, limited := rateLimitWait(err)
+		if !limited || attempt == rateLimitRetries {
+			return err
+		}
+		log.Println("Rate limited by Discord - waiting", wait, "before trying again")
+		time.Sleep(wait)
+	}
+}
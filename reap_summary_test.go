@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestReapSummaryMessageFailureReasons(t *testing.T) {
+	summary := newReapSummary(1)
+	summary.fail(10, 0, errors.New(strings.Repeat("é", 200)))
+	summary.fail(0, 0, errors.New("short"))
+
+	message := summary.Message()
+	if !utf8.ValidString(message) {
+		t.Errorf("Message() isn't valid UTF-8: %q", message)
+	}
+	if want := "- <#10>: " + strings.Repeat("é", maxSummaryReasonLength) + "…\n"; !strings.Contains(message, want) {
+		t.Errorf("Message() = %q, want it to contain %q", message, want)
+	}
+	if !strings.HasSuffix(message, "\n- short") {
+		t.Errorf("Message() = %q, want it to end with the short reason", message)
+	}
+}
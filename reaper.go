@@ -2,51 +2,242 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"time"
 
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 )
 
-// ReapChannelMessages takes a Discord channel ID, the amount of time to reap messages from, and the
-// Discord API state. It then deletes messages older than the given duration in the given channel,
-// excluding only messages that are pinned.
-func (b *Bot) ReapChannelMessages(channel discord.ChannelID, reapDuration time.Duration) error {
-	limit := time.Now().UTC().Add(-reapDuration)
+// ReapConfiguredChannels reaps every channel configured to be reaped in the guilds given,
+// or just those in channelIDs if it isn't empty, and returns a summary for each guild.
+func (b *Bot) ReapConfiguredChannels(guilds map[discord.GuildID]GuildConfig, channelIDs snowflakeListFlag, dryRun bool) []*ReapSummary {
+	summaries := []*ReapSummary{}
+	for guildID, guildConfig := range guilds {
+		summary := newReapSummary(guildID)
+		if dryRun {
+			summary.Preview = newReapPreview()
+		}
+		channels, err := b.reapedChannels(guildID, guildConfig)
+		if err != nil {
+			summary.fail(0, 0, fmt.Errorf("failed listing the guild's channels, so only those it lists were reaped: %w", err))
+		}
+		for channelID, channelConfig := range channels {
+			if !channelIDs.Contains(discord.Snowflake(channelID)) {
+				continue
+			}
+
+			log.Println("Reaping channel", channelID, "from guild", guildID)
+			b.ReapChannel(guildID, channelID, channelConfig, summary)
+		}
+
+		b.postReapSummary(summary)
+		summaries = append(summaries, summary)
+	}
 
-	channelMessages, err := b.State.Messages(channel, 0)
+	// channels that aren't reaped any more never have their archives pruned as they're reaped
+	if !dryRun {
+		b.sweepArchives(currentConfig())
+	}
+	return summaries
+}
+
+// ReapChannel reaps a configured channel and each of its threads or forum posts, noting
+// anything that fails in the summary.
+func (b *Bot) ReapChannel(guildID discord.GuildID, channelID discord.ChannelID, channelConfig ChannelConfig, summary *ReapSummary) {
+	channel, err := b.State.Channel(channelID)
 	if err != nil {
-		return err
+		summary.fail(channelID, 0, fmt.Errorf("failed fetching channel: %w", err))
+		return
 	}
 
+	if channelConfig.ArchiveRetention > 0 && summary.Preview == nil {
+		if _, err := pruneChannelArchive(guildID, *channel, time.Duration(channelConfig.ArchiveRetention)); err != nil {
+			log.Println("Failed pruning the archive for channel", channelID, "with error", err)
+		}
+	}
+
+	// forums only have messages in their posts
+	if channel.Type != GuildForum {
+		b.reapChannelOrThread(guildID, *channel, channelConfig, summary)
+	}
+	// a thread can be configured by itself, but can't have threads of its own
+	if isThread(*channel) {
+		return
+	}
+	b.reapThreads(guildID, *channel, channelConfig, summary)
+}
+
+// reapChannelOrThread reaps the messages in a channel or thread, noting in the summary
+// whether it succeeded, and returning whether it did and how many old messages were left.
+func (b *Bot) reapChannelOrThread(guildID discord.GuildID, channel discord.Channel, channelConfig ChannelConfig, summary *ReapSummary) (int, bool) {
+	left, err := b.ReapChannelMessages(guildID, channel, channelConfig, summary)
+	if err != nil {
+		summary.fail(channel.ID, 0, err)
+		return left, false
+	}
+	summary.ChannelsProcessed++
+	return left, true
+}
+
+// reapPageSize is how many messages the reaper fetches at once - the most Discord allows.
+const reapPageSize = 100
+
+// ReapChannelMessages deletes the messages in a channel or thread that are older than its
+// reap duration and not kept by its keep rules. It returns how many old messages were left.
+func (b *Bot) ReapChannelMessages(guildID discord.GuildID, target discord.Channel, channelConfig ChannelConfig, summary *ReapSummary) (int, error) {
+	channel := target.ID
+	startedAt := time.Now()
+	limit := startedAt.UTC().Add(-time.Duration(channelConfig.ReapDuration))
+
 	reason := api.AuditLogReason(fmt.Sprintf("Reaping messages in channel %s before %s", channel, limit.Format(time.RFC822)))
 
-	batchDeletionQueue := []discord.MessageID{}
-
-	for i := len(channelMessages) - 1; i >= 0; i-- {
-		if channelMessages[i].Timestamp.Time().UTC().Before(limit) {
-			if !channelMessages[i].Pinned {
-				// if it's been less than 13 days since the message was sent, we can queue it for batch deletion
-				// technically, the limit is 14 days - but to avoid issues where we might be just on the cusp of
-				// 14, this uses 13 for safety
-				if time.Now().AddDate(0, 0, -13).Before(channelMessages[i].Timestamp.Time()) {
-					batchDeletionQueue = append(batchDeletionQueue, channelMessages[i].ID)
-				} else {
-					// more than 13 days? delete the message one by one... :c
-					err = b.State.DeleteMessage(channel, channelMessages[i].ID, reason)
-					if err != nil {
-						return err
+	rules, err := b.keepRules(channelConfig, newMemberRolesCache(b, guildID))
+	if err != nil {
+		return 0, fmt.Errorf("failed setting up keep rules: %w", err)
+	}
+	unarchived := false
+	left := 0
+
+	// the archive is only created once there's something to put in it
+	var archive *reapArchive
+	defer func() {
+		if archive != nil {
+			if err := archive.Close(); err != nil {
+				log.Println("Failed closing the archive for channel", channel, "with error", err)
+			}
+		}
+	}()
+
+	// message IDs start with when the message was sent, so this is just after the newest message to reap
+	before := discord.MessageID(discord.NewSnowflake(limit))
+
+	// working back a page at a time means a channel's whole history is never held in memory
+	for {
+		// pages come newest first, and every message in them is older than before
+		var page []discord.Message
+		err := withRateLimitRetries(func() (err error) {
+			page, err = b.State.MessagesBefore(channel, before, reapPageSize)
+			return err
+		})
+		if err != nil {
+			return left, fmt.Errorf("failed fetching messages: %w", err)
+		}
+
+		reapable := []discord.Message{}
+		for _, message := range page {
+			if !message.Timestamp.Time().UTC().Before(limit) {
+				continue
+			}
+			if rule := keptBy(rules, message); rule != nil {
+				summary.Skipped[rule.Name]++
+				left++
+				continue
+			}
+			reapable = append(reapable, message)
+		}
+
+		// a dry run only records what would be reaped
+		if summary.Preview != nil {
+			summary.Preview.add(reapable)
+			if len(page) < reapPageSize {
+				return left, nil
+			}
+			before = page[len(page)-1].ID
+			continue
+		}
+
+		if channelConfig.Archive && len(reapable) > 0 {
+			if archive == nil {
+				archive, err = openReapArchive(guildID, target, startedAt)
+				if err != nil {
+					return left, fmt.Errorf("failed creating archive: %w", err)
+				}
+			}
+			// nothing is deleted unless it's safely archived
+			if err := archive.Write(guildID, reapable); err != nil {
+				return left, fmt.Errorf("failed archiving messages: %w", err)
+			}
+		}
+
+		// messages can't be deleted from archived threads, so they're only unarchived once there's something to delete
+		if len(reapable) > 0 && threadArchived(target) && !unarchived {
+			if err := b.setThreadArchived(target, false); err != nil {
+				return left, fmt.Errorf("failed unarchiving thread: %w", err)
+			}
+			unarchived = true
+			defer func() {
+				if err := b.setThreadArchived(target, true); err != nil {
+					log.Println("Failed archiving thread", channel, "again with error", err)
+				}
+			}()
+		}
+
+		// messages that fail to delete are noted in the summary and left, and the rest are still reaped
+		batchDeletionQueue := []discord.MessageID{}
+
+		for _, message := range reapable {
+			// if it's been less than 13 days since the message was sent, we can queue it for batch deletion
+			// technically, the limit is 14 days - but to avoid issues where we might be just on the cusp of
+			// 14, this uses 13 for safety
+			if time.Now().AddDate(0, 0, -13).Before(message.Timestamp.Time()) {
+				batchDeletionQueue = append(batchDeletionQueue, message.ID)
+			} else {
+				// more than 13 days? delete the message one by one... :c
+				if !b.deleteMessage(channel, message.ID, reason, summary) {
+					left++
+				}
+			}
+		}
+
+		switch len(batchDeletionQueue) {
+		case 0:
+		case 1:
+			// bulk deletion needs at least two messages, so a lone one is deleted by itself
+			if !b.deleteMessage(channel, batchDeletionQueue[0], reason, summary) {
+				left++
+			}
+		default:
+			// a page is at most 100 messages, which is as many as can be deleted in one request
+			err = withRateLimitRetries(func() error {
+				return b.State.DeleteMessages(channel, batchDeletionQueue, reason)
+			})
+			if err != nil {
+				// one bad message fails the whole batch, so try them one by one to find it
+				log.Println("Bulk deleting messages in channel", channel, "failed with error", err, "- deleting them one by one")
+				for _, messageID := range batchDeletionQueue {
+					if !b.deleteMessage(channel, messageID, reason, summary) {
+						left++
 					}
 				}
+			} else {
+				summary.BulkDeleted += len(batchDeletionQueue)
 			}
-		} else {
-			// it's now a waste of time processing any further messages, as we are in present territory!
-			// yay :3
-			break
 		}
+
+		if len(page) < reapPageSize {
+			// we've reached the start of the channel
+			return left, nil
+		}
+		before = page[len(page)-1].ID
 	}
+}
 
-	// these messages we can batch request - the 100 per request is handled by Arikawa
-	err = b.State.DeleteMessages(channel, batchDeletionQueue, reason)
-	return err
+// deleteMessage deletes a single message, noting in the summary whether it succeeded,
+// and returning whether the message is gone. Messages that have already been deleted
+// are skipped.
+func (b *Bot) deleteMessage(channelID discord.ChannelID, messageID discord.MessageID, reason api.AuditLogReason, summary *ReapSummary) bool {
+	err := withRateLimitRetries(func() error {
+		return b.State.DeleteMessage(channelID, messageID, reason)
+	})
+	switch {
+	case err == nil:
+		summary.IndividuallyDeleted++
+	case isNotFound(err):
+		// someone got there first
+	default:
+		summary.fail(channelID, messageID, err)
+		return false
+	}
+	return true
 }
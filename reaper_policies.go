@@ -0,0 +1,76 @@
+package main
+
+import (
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// hasReaperDefaults checks whether a guild reaps channels by their category or by default,
+// rather than only those listed in its channels.
+func (g GuildConfig) hasReaperDefaults() bool {
+	return g.Reaper != nil || len(g.Categories) > 0
+}
+
+// isExcluded checks whether a channel, or the category it's in, is excluded from being
+// reaped by the guild's defaults. The guild's report and reaper log channels always are,
+// as reaping them would lose what the bot's told committee.
+func (g GuildConfig) isExcluded(channel discord.Channel) bool {
+	if channel.ID == g.ReportChannel || channel.ID == g.ReaperLogChannel {
+		return true
+	}
+	for _, excludedID := range g.ExcludeChannels {
+		if excludedID == channel.ID || channel.ParentID.IsValid() && excludedID == channel.ParentID {
+			return true
+		}
+	}
+	return false
+}
+
+// reapPolicy works out how a channel is reaped - by its own config if it has one, or
+// else by its category's, or else by the guild's default. It returns false if the
+// channel isn't reaped.
+func (g GuildConfig) reapPolicy(channel discord.Channel) (ChannelConfig, bool) {
+	if channelConfig, ok := g.Channels[channel.ID]; ok {
+		return channelConfig, true
+	}
+
+	// threads are reaped along with their channel, and other kinds of channel have no messages to reap
+	if channel.Type != discord.GuildText && channel.Type != discord.GuildNews && channel.Type != GuildForum {
+		return ChannelConfig{}, false
+	}
+	if g.isExcluded(channel) {
+		return ChannelConfig{}, false
+	}
+
+	if channelConfig, ok := g.Categories[channel.ParentID]; ok && channel.ParentID.IsValid() {
+		return channelConfig, true
+	}
+	if g.Reaper != nil {
+		return *g.Reaper, true
+	}
+	return ChannelConfig{}, false
+}
+
+// reapedChannels works out which of a guild's channels are reaped and how, from the
+// channels it has now. If they can't be looked up, the channels the guild lists are
+// still returned along with the error.
+func (b *Bot) reapedChannels(guildID discord.GuildID, guildConfig GuildConfig) (map[discord.ChannelID]ChannelConfig, error) {
+	reaped := map[discord.ChannelID]ChannelConfig{}
+	for channelID, channelConfig := range guildConfig.Channels {
+		reaped[channelID] = channelConfig
+	}
+	// guilds that only reap the channels they list don't need their channels looking up
+	if !guildConfig.hasReaperDefaults() {
+		return reaped, nil
+	}
+
+	channels, err := b.State.Channels(guildID)
+	if err != nil {
+		return reaped, err
+	}
+	for _, channel := range channels {
+		if channelConfig, ok := guildConfig.reapPolicy(channel); ok {
+			reaped[channel.ID] = channelConfig
+		}
+	}
+	return reaped, nil
+}
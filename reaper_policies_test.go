@@ -0,0 +1,51 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestReapPolicy(t *testing.T) {
+	channelConfig := ChannelConfig{ReapDuration: Duration(time.Hour)}
+	categoryConfig := ChannelConfig{ReapDuration: Duration(2 * time.Hour)}
+	defaultConfig := ChannelConfig{ReapDuration: Duration(3 * time.Hour)}
+	guildConfig := GuildConfig{
+		Channels:         ChannelConfigs{10: channelConfig, 15: channelConfig},
+		Categories:       CategoryConfigs{20: categoryConfig},
+		Reaper:           &defaultConfig,
+		ExcludeChannels:  []discord.ChannelID{11, 21},
+		ReportChannel:    12,
+		ReaperLogChannel: 13,
+	}
+
+	tests := []struct {
+		name       string
+		channel    discord.Channel
+		want       ChannelConfig
+		wantReaped bool
+	}{
+		{"configured channel", discord.Channel{ID: 10, Type: discord.GuildText}, channelConfig, true},
+		{"configured channel that's also the report channel", discord.Channel{ID: 15, Type: discord.GuildText}, channelConfig, true},
+		{"channel in a category", discord.Channel{ID: 14, ParentID: 20, Type: discord.GuildText}, categoryConfig, true},
+		{"other channel", discord.Channel{ID: 14, Type: discord.GuildNews}, defaultConfig, true},
+		{"forum", discord.Channel{ID: 14, Type: GuildForum}, defaultConfig, true},
+		{"voice channel", discord.Channel{ID: 14, Type: discord.GuildVoice}, ChannelConfig{}, false},
+		{"thread", discord.Channel{ID: 14, ParentID: 10, Type: discord.GuildPublicThread}, ChannelConfig{}, false},
+		{"excluded channel", discord.Channel{ID: 11, Type: discord.GuildText}, ChannelConfig{}, false},
+		{"channel in an excluded category", discord.Channel{ID: 14, ParentID: 21, Type: discord.GuildText}, ChannelConfig{}, false},
+		{"report channel", discord.Channel{ID: 12, ParentID: 20, Type: discord.GuildText}, ChannelConfig{}, false},
+		{"reaper log channel", discord.Channel{ID: 13, Type: discord.GuildText}, ChannelConfig{}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, reaped := guildConfig.reapPolicy(test.channel)
+			if !reflect.DeepEqual(got, test.want) || reaped != test.wantReaped {
+				t.Errorf("reapPolicy = %+v, %v, want %+v, %v", got, reaped, test.want, test.wantReaped)
+			}
+		})
+	}
+}
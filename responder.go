@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// autoDeferAfter is how long a handler can take before the dispatcher defers its
+// interaction for it. Discord gives us three seconds to respond to an interaction,
+// so this leaves some headroom for the deferral itself to get there.
+const autoDeferAfter = 2 * time.Second
+
+// DeferKind says how an interaction is deferred if its handler is slow to respond, which
+// needs to match how the handler goes on to respond.
+type DeferKind int
+
+const (
+	// DeferEphemeral shows a loading message only the member can see, for handlers that
+	// reply privately.
+	DeferEphemeral DeferKind = iota
+	// DeferPublic shows a loading message everyone can see, for handlers that post in the channel.
+	DeferPublic
+	// DeferUpdate acknowledges a component without showing anything, for handlers that
+	// update the message it's on. Other responses are sent as followups.
+	DeferUpdate
+)
+
+// InteractionResponder responds to an interaction, keeping track of whether it's
+// already been responded to or deferred, so that handlers don't need to care -
+// a response after a deferral edits the deferred message, and any response after
+// that is sent as a followup.
+type InteractionResponder struct {
+	bot *Bot
+	e   *gateway.InteractionCreateEvent
+
+	mutex     sync.Mutex
+	responded bool
+	deferred  bool
+	deferKind DeferKind
+}
+
+// responders holds the responders for the interactions currently being handled, by interaction ID.
+var responders sync.Map
+
+// responder returns the responder for an interaction. Interactions going through the
+// dispatcher share one responder for the whole time they're being handled.
+func (bot *Bot) responder(e *gateway.InteractionCreateEvent) *InteractionResponder {
+	if r, ok := responders.Load(e.ID); ok {
+		return r.(*InteractionResponder)
+	}
+
+	return &InteractionResponder{bot: bot, e: e}
+}
+
+// Respond sends a response to the interaction. If the interaction has been deferred,
+// the deferred response is edited to hold the response instead, and if it's already
+// been responded to, the response is sent as a followup message.
+func (r *InteractionResponder) Respond(response api.InteractionResponse) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case !r.responded:
+		if err := r.bot.State.RespondInteraction(r.e.ID, r.e.Token, response); err != nil {
+			return err
+		}
+		r.responded = true
+		return nil
+	case r.deferred && (r.deferKind != DeferUpdate || response.Type == api.UpdateMessage):
+		r.deferred = false
+
+		data := api.EditInteractionResponseData{}
+		if response.Data != nil {
+			data.Content = response.Data.Content
+			data.Embeds = response.Data.Embeds
+			data.Components = response.Data.Components
+			data.AllowedMentions = response.Data.AllowedMentions
+		}
+
+		_, err := r.bot.State.EditInteractionResponse(r.e.AppID, r.e.Token, data)
+		return err
+	default:
+		data := api.InteractionResponseData{}
+		if response.Data != nil {
+			data = *response.Data
+		}
+
+		_, err := r.bot.State.CreateInteractionFollowup(r.e.AppID, r.e.Token, data)
+		return err
+	}
+}
+
+// Defer acknowledges the interaction without responding yet, so the handler can take
+// longer than Discord usually allows. Unless it's deferred as an update, Discord shows
+// the user a loading message, which is replaced by the next response. It does nothing
+// if the interaction's already been responded to.
+func (r *InteractionResponder) Defer(kind DeferKind) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if r.responded {
+		return nil
+	}
+
+	response := api.InteractionResponse{Type: api.DeferredMessageInteractionWithSource}
+	switch kind {
+	case DeferEphemeral:
+		response.Data = &api.InteractionResponseData{Flags: api.EphemeralResponse}
+	case DeferUpdate:
+		response.Type = api.DeferredMessageUpdate
+	}
+
+	if err := r.bot.State.RespondInteraction(r.e.ID, r.e.Token, response); err != nil {
+		return err
+	}
+
+	r.responded = true
+	r.deferred = true
+	r.deferKind = kind
+	return nil
+}
+
+// Followup sends a followup message for the interaction, once it's been responded to.
+func (r *InteractionResponder) Followup(data api.InteractionResponseData) (*discord.Message, error) {
+	return r.bot.State.CreateInteractionFollowup(r.e.AppID, r.e.Token, data)
+}
+
+// EditOriginal edits the message sent as the interaction's response.
+func (r *InteractionResponder) EditOriginal(data api.EditInteractionResponseData) (*discord.Message, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.deferred = false
+	return r.bot.State.EditInteractionResponse(r.e.AppID, r.e.Token, data)
+}
+
+// interactionDeferKind works out how an interaction should be deferred to match how its
+// handler responds. Components are deferred as updates, and commands ephemerally unless
+// they say otherwise, as most of the bot's responses are.
+func interactionDeferKind(e *gateway.InteractionCreateEvent) DeferKind {
+	switch data := e.Data.(type) {
+	case *discord.CommandInteraction:
+		if command := findCommand(commandInteractionType(data), data.Name); command != nil {
+			return command.deferKind(data)
+		}
+		return DeferEphemeral
+	case *discord.ButtonInteraction, *discord.SelectInteraction, *discord.ModalInteraction:
+		return DeferUpdate
+	default:
+		return DeferEphemeral
+	}
+}
+
+// autoDeferInteractions gives each interaction a shared responder, and defers the
+// interaction if its handler hasn't responded by the time autoDeferAfter is up.
+func (bot *Bot) autoDeferInteractions(next InteractionHandler) InteractionHandler {
+	return func(e *gateway.InteractionCreateEvent) error {
+		r := &InteractionResponder{bot: bot, e: e}
+		responders.Store(e.ID, r)
+		defer responders.Delete(e.ID)
+
+		// autocomplete interactions can't be deferred
+		if _, isAutocomplete := e.Data.(*discord.AutocompleteInteraction); !isAutocomplete {
+			kind := interactionDeferKind(e)
+			timer := time.AfterFunc(autoDeferAfter, func() {
+				if err := r.Defer(kind); err != nil {
+					log.Println("Failed deferring slow interaction", e.ID, "with error", err)
+				}
+			})
+			defer timer.Stop()
+		}
+
+		return next(e)
+	}
+}
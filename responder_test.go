@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+func TestInteractionDeferKind(t *testing.T) {
+	tests := []struct {
+		name string
+		data discord.InteractionData
+		want DeferKind
+	}{
+		{"command", &discord.CommandInteraction{Name: "setup"}, DeferEphemeral},
+		{"unknown command", &discord.CommandInteraction{Name: "nonexistent"}, DeferEphemeral},
+		{"public subcommand", &discord.CommandInteraction{Name: "picker", Options: []discord.CommandInteractionOption{{Name: "create"}}}, DeferPublic},
+		{"ephemeral subcommand", &discord.CommandInteraction{Name: "picker", Options: []discord.CommandInteractionOption{{Name: "refresh"}}}, DeferEphemeral},
+		{"button", &discord.ButtonInteraction{CustomID: "v1:verify"}, DeferUpdate},
+		{"select", &discord.SelectInteraction{CustomID: "v1:setup:roles"}, DeferUpdate},
+		{"modal", &discord.ModalInteraction{CustomID: "v1:colour"}, DeferUpdate},
+		{"ping", &discord.PingInteraction{}, DeferEphemeral},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			e := &gateway.InteractionCreateEvent{InteractionEvent: discord.InteractionEvent{Data: test.data}}
+			if got := interactionDeferKind(e); got != test.want {
+				t.Errorf("interactionDeferKind = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+// offeredPickerRole returns the configuration for a role offered by a picker of
+// the given kind in a guild's current config, or nil if it isn't offered. Pickers
+// can outlive the config they were posted with, so buttons are always checked
+// against this before a role is handed out.
+func offeredPickerRole(kind PickerKind, guildID discord.GuildID, roleName string) *RoleConfig {
+	var offered []RoleConfig
+	switch kind {
+	case PronounPicker:
+		for _, pronoun := range currentConfig().GuildPronouns(guildID) {
+			offered = append(offered, RoleConfig{Name: pronoun})
+		}
+	case ColourPicker:
+		for _, colour := range currentConfig().Guilds[guildID].Colours {
+			offered = append(offered, RoleConfig{Name: colour})
+		}
+	case RolePicker:
+		offered = currentConfig().Guilds[guildID].AllRoles()
+	}
+
+	for _, role := range offered {
+		if strings.EqualFold(role.Name, roleName) {
+			return &role
+		}
+	}
+
+	return nil
+}
+
+// unmetRoleRequirement checks whether a member meets the prerequisites to take a role.
+// It returns a message for the member explaining what they're missing, or an
+// empty string if they're allowed to take the role.
+func (bot *Bot) unmetRoleRequirement(member *discord.Member, guildID discord.GuildID, role RoleConfig) (string, error) {
+	if role.RequiresVerified {
+		verifiedRole, err := bot.getVerifiedRole(guildID)
+		if err != nil {
+			return "", err
+		}
+
+		if !memberHasRole(member, *verifiedRole) {
+			return fmt.Sprintf("You'll need to get verified before you can have the %s role.", role.Name), nil
+		}
+	}
+
+	if role.StudentType != "" {
+		studentType := GetStudentTypeFromName(role.StudentType)
+		if studentType == nil {
+			return "", fmt.Errorf("role %s requires unknown student type %q", role.Name, role.StudentType)
+		}
+
+		if authenticated, _ := isDiscordAuthenticated(member.User, studentType); !authenticated {
+			return fmt.Sprintf("Sorry, the %s role is only for members verified as %s.", role.Name, aOrAn(studentType.Name())), nil
+		}
+	}
+
+	if len(role.ConflictsWith) > 0 {
+		guildRoles, err := bot.State.Roles(guildID)
+		if err != nil {
+			return "", err
+		}
+
+		for _, guildRole := range guildRoles {
+			if !memberHasRole(member, guildRole.ID) {
+				continue
+			}
+
+			for _, conflict := range role.ConflictsWith {
+				if strings.EqualFold(guildRole.Name, conflict) {
+					return fmt.Sprintf("You can't have the %s role while you've got the %s role - remove that one first.", role.Name, guildRole.Name), nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// memberHasRole returns true if the member holds the role with the given ID.
+func memberHasRole(member *discord.Member, roleID discord.RoleID) bool {
+	for _, memberRoleID := range member.RoleIDs {
+		if memberRoleID == roleID {
+			return true
+		}
+	}
+	return false
+}
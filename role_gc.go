@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// createdRolesFile is the data file that records every role the bot has created.
+const createdRolesFile = "created_roles.json"
+
+// CreatedRole records a role that the bot created itself.
+type CreatedRole struct {
+	RoleID    discord.RoleID `json:"roleID"`
+	Name      string         `json:"name"`
+	CreatedAt time.Time      `json:"createdAt"`
+}
+
+// createdRoles maps guild IDs to the roles the bot has created in them, guarded by createdRolesMutex.
+var createdRoles = map[discord.GuildID][]CreatedRole{}
+var createdRolesMutex sync.Mutex
+
+// loadCreatedRoles reads the roles the bot has created in from the data directory.
+func loadCreatedRoles() error {
+	createdRolesMutex.Lock()
+	defer createdRolesMutex.Unlock()
+
+	return loadJSON(createdRolesFile, &createdRoles)
+}
+
+// recordCreatedRole remembers that the bot created a role, so it can be cleaned up later.
+func recordCreatedRole(guildID discord.GuildID, role *discord.Role) {
+	createdRolesMutex.Lock()
+	defer createdRolesMutex.Unlock()
+
+	createdRoles[guildID] = append(createdRoles[guildID], CreatedRole{
+		RoleID:    role.ID,
+		Name:      role.Name,
+		CreatedAt: time.Now(),
+	})
+
+	if err := saveJSON(createdRolesFile, createdRoles); err != nil {
+		log.Println("Failed recording created role", role.Name, "with error", err)
+	}
+}
+
+// CreatedRoleUsage describes how a role the bot created is being used.
+type CreatedRoleUsage struct {
+	Role       discord.Role
+	Members    int
+	Referenced bool
+}
+
+// Deletable returns true if nobody holds the role, and the config doesn't use it.
+func (u CreatedRoleUsage) Deletable() bool {
+	return u.Members == 0 && !u.Referenced
+}
+
+// createdRoleUsage lists each role the bot created in a guild that still exists, along
+// with how many members hold it and whether the config still references it. Roles
+// that have been deleted since are forgotten.
+func (bot *Bot) createdRoleUsage(guildID discord.GuildID) ([]CreatedRoleUsage, error) {
+	guildRoles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	// a role only looks empty if every member has been counted, so any failure stops here
+	memberCounts, err := bot.roleMemberCounts(guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed counting the members holding each role: %w", err)
+	}
+
+	createdRolesMutex.Lock()
+	defer createdRolesMutex.Unlock()
+
+	usages := []CreatedRoleUsage{}
+	stillExisting := []CreatedRole{}
+	for _, created := range createdRoles[guildID] {
+		for _, role := range guildRoles {
+			if role.ID == created.RoleID {
+				stillExisting = append(stillExisting, created)
+				usages = append(usages, CreatedRoleUsage{
+					Role:       role,
+					Members:    memberCounts[role.ID],
+					Referenced: isRoleReferenced(guildID, role),
+				})
+				break
+			}
+		}
+	}
+
+	if len(stillExisting) != len(createdRoles[guildID]) {
+		createdRoles[guildID] = stillExisting
+		if err := saveJSON(createdRolesFile, createdRoles); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Slice(usages, func(i, j int) bool {
+		return strings.ToLower(usages[i].Role.Name) < strings.ToLower(usages[j].Role.Name)
+	})
+
+	return usages, nil
+}
+
+// roleMemberCounts counts how many of a guild's members hold each role. The state only
+// caches some members, so every member is fetched from Discord, a page at a time.
+func (bot *Bot) roleMemberCounts(guildID discord.GuildID) (map[discord.RoleID]int, error) {
+	memberCounts := map[discord.RoleID]int{}
+	after := discord.UserID(0)
+	for {
+		members, err := bot.State.Session.MembersAfter(guildID, after, api.MaxMemberFetchLimit)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, member := range members {
+			for _, roleID := range member.RoleIDs {
+				memberCounts[roleID]++
+			}
+		}
+
+		// a short page is the last one
+		if len(members) < api.MaxMemberFetchLimit {
+			return memberCounts, nil
+		}
+		after = members[len(members)-1].User.ID
+	}
+}
+
+// isRoleReferenced returns true if a role is still in use by the guild's config -
+// as a pronoun, colour or picker role, or as somebody's custom colour.
+func isRoleReferenced(guildID discord.GuildID, role discord.Role) bool {
+	names := append([]string{}, currentConfig().GuildPronouns(guildID)...)
+	names = append(names, currentConfig().Guilds[guildID].Colours...)
+	names = append(names, RoleNames(currentConfig().Guilds[guildID].AllRoles())...)
+
+	for _, name := range names {
+		if strings.EqualFold(name, role.Name) {
+			return true
+		}
+	}
+
+	customColourRolesMutex.Lock()
+	defer customColourRolesMutex.Unlock()
+
+	for _, roleID := range customColourRoles[guildID] {
+		if roleID == role.ID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// deleteUnusedCreatedRoles deletes every role the bot created in a guild that has no
+// members and isn't referenced by config. It returns the names of the roles deleted.
+func (bot *Bot) deleteUnusedCreatedRoles(guildID discord.GuildID) ([]string, error) {
+	usages, err := bot.createdRoleUsage(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := []string{}
+	for _, usage := range usages {
+		if !usage.Deletable() {
+			continue
+		}
+
+		err := bot.State.DeleteRole(guildID, usage.Role.ID, "Cleaning up an empty role that's no longer in the config")
+		if err != nil && !isNotFound(err) {
+			return deleted, err
+		}
+
+		deleted = append(deleted, usage.Role.Name)
+	}
+
+	return deleted, nil
+}
+
+// formatCreatedRoleUsage describes the usage of created roles as a list, one role per line.
+func formatCreatedRoleUsage(usages []CreatedRoleUsage) string {
+	var b strings.Builder
+	for _, usage := range usages {
+		status := "in config"
+		if !usage.Referenced {
+			status = "not in config"
+		}
+
+		marker := "•"
+		if usage.Deletable() {
+			marker = "🗑️"
+		}
+
+		fmt.Fprintf(&b, "%s %s - %d members, %s\n", marker, usage.Role.Name, usage.Members, status)
+	}
+	return b.String()
+}
+
+// CollectGarbageRoles runs role garbage collection from the command line. For each
+// guild, it lists the roles the bot has created, and deletes the unused ones once
+// the operator has confirmed it's OK to.
+func (bot *Bot) CollectGarbageRoles() {
+	stdin := bufio.NewReader(os.Stdin)
+
+	for guildID := range currentConfig().Guilds {
+		usages, err := bot.createdRoleUsage(guildID)
+		if err != nil {
+			log.Println("Failed listing created roles in guild", guildID, "with error", err)
+			continue
+		}
+
+		deletable := 0
+		for _, usage := range usages {
+			if usage.Deletable() {
+				deletable++
+			}
+		}
+
+		fmt.Printf("Guild %s has %d roles created by the bot:\n%s", guildID, len(usages), formatCreatedRoleUsage(usages))
+		if deletable == 0 {
+			fmt.Println("Nothing to clean up.")
+			continue
+		}
+
+		fmt.Printf("Delete %d empty roles that aren't in the config? [y/N] ", deletable)
+		answer, _ := stdin.ReadString('\n')
+		if !strings.EqualFold(strings.TrimSpace(answer), "y") {
+			continue
+		}
+
+		deleted, err := bot.deleteUnusedCreatedRoles(guildID)
+		log.Println("Deleted roles", deleted, "from guild", guildID)
+		if err != nil {
+			log.Println("Failed deleting some roles in guild", guildID, "with error", err)
+		}
+	}
+}
+
+// OnGarbageRolesCommand is run by the interaction event dispatcher when the command
+// to clean up unused roles is activated. It lists the roles that would be deleted, and
+// asks for confirmation.
+func (bot *Bot) OnGarbageRolesCommand(e *gateway.InteractionCreateEvent) error {
+	usages, err := bot.createdRoleUsage(e.GuildID)
+	if err != nil {
+		return err
+	}
+
+	// only the roles that would be deleted are listed, as a guild can have too many created roles to fit in a message
+	deletable := []CreatedRoleUsage{}
+	for _, usage := range usages {
+		if usage.Deletable() {
+			deletable = append(deletable, usage)
+		}
+	}
+
+	if len(deletable) == 0 {
+		return bot.respondEphemerally(e, fmt.Sprintf("No empty roles to clean up 🧹 The bot's created %d roles, and they're all in use or in the config.", len(usages)))
+	}
+
+	content := fmt.Sprintf("These %d roles created by the bot would be deleted", len(deletable))
+	if kept := len(usages) - len(deletable); kept > 0 {
+		content += fmt.Sprintf(" - %d more are in use or in the config, so they're kept", kept)
+	}
+	content += ":\n" + formatCreatedRoleUsage(deletable)
+
+	return bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.MessageInteractionWithSource,
+		Data: &api.InteractionResponseData{
+			Content: option.NewNullableString(truncateMessage(content)),
+			Flags:   api.EphemeralResponse,
+			Components: discord.ComponentsPtr(
+				&discord.ActionRowComponent{
+					&discord.ButtonComponent{
+						CustomID: CustomID{Type: GarbageRolesConfirmID}.Encode(),
+						Label:    fmt.Sprintf("Delete %d empty roles", len(deletable)),
+						Style:    discord.DangerButtonStyle(),
+					},
+				},
+			),
+		},
+	})
+}
+
+// OnGarbageRolesConfirmButton is run by the interaction event dispatcher when the button
+// confirming that unused roles should be deleted is pressed.
+func (bot *Bot) OnGarbageRolesConfirmButton(e *gateway.InteractionCreateEvent) error {
+	deleted, err := bot.deleteUnusedCreatedRoles(e.GuildID)
+
+	// the failure's noted before the roles' names, so that it isn't cut off when there are lots of them
+	message := fmt.Sprintf("Deleted %d roles", len(deleted))
+	if err != nil {
+		message += " - some couldn't be deleted, though, so check the logs for details"
+	}
+	message += ": " + strings.Join(deleted, ", ")
+
+	if respondErr := bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.UpdateMessage,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(truncateMessage(message)),
+			Components: &discord.ContainerComponents{},
+		},
+	}); respondErr != nil {
+		return respondErr
+	}
+
+	return err
+}
@@ -45,3 +45,14 @@ func GetStudentTypeFromCode(code string) StudentType {
 	}
 	return nil
 }
+
+// GetStudentTypeFromName returns a StudentType corresponding to a given
+// name, as returned by StudentType.Name, or nil if the student type does not exist.
+func GetStudentTypeFromName(name string) StudentType {
+	for _, studentType := range []StudentType{&Alumnus{}, &CurrentStudent{}} {
+		if strings.EqualFold(name, studentType.Name()) {
+			return studentType
+		}
+	}
+	return nil
+}
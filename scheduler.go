@@ -0,0 +1,442 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+)
+
+// jobHistoryFile is the data file that the history of scheduled job runs is kept in.
+const jobHistoryFile = "job_history.json"
+
+// maxJobHistory is how many runs of each job are kept in the history.
+const maxJobHistory = 20
+
+// schedulerRecheckInterval is the longest the scheduler waits before looking at the
+// config again, so that changes to when jobs run are picked up when it's reloaded.
+const schedulerRecheckInterval = time.Minute
+
+// schedulerMinimumWait is the shortest the scheduler waits between runs of a job, so that
+// a job that's always due can't keep it spinning.
+const schedulerMinimumWait = time.Second
+
+// Job is a task the bot runs on a schedule while it's serving.
+type Job struct {
+	Name        string
+	Description string
+	// Default is when the job runs if the config doesn't say, or nil if it only runs when configured.
+	Default *JobConfig
+	// Run runs the job, returning a short summary of what it did.
+	Run func(bot *Bot, jobConfig JobConfig) (string, error)
+	// Wake, if set, makes the job run straight away when something is sent on it.
+	Wake <-chan struct{}
+	// NextDue, if set, returns when the job next has something to do, if that's known,
+	// so that it can run then rather than waiting for its schedule.
+	NextDue func() (time.Time, bool)
+}
+
+// JobRun records a run of a scheduled job.
+type JobRun struct {
+	Job       string        `json:"job"`
+	StartedAt time.Time     `json:"startedAt"`
+	Duration  time.Duration `json:"duration"`
+	Summary   string        `json:"summary,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	// Manual is set when the run was asked for with /jobs run, rather than scheduled.
+	Manual bool `json:"manual,omitempty"`
+}
+
+// jobs are the jobs the scheduler runs.
+var jobs = []Job{
+	{
+		Name:        "reap",
+		Description: "Deletes old messages from the channels configured to be reaped",
+		Run: func(bot *Bot, jobConfig JobConfig) (string, error) {
+			channels, bulk, individually, failures := 0, 0, 0, 0
+			for _, summary := range bot.ReapConfiguredChannels(currentConfig().Guilds, nil, false) {
+				channels += summary.ChannelsProcessed
+				bulk += summary.BulkDeleted
+				individually += summary.IndividuallyDeleted
+				failures += len(summary.Failures)
+			}
+
+			result := fmt.Sprintf("reaped %d channels and threads, deleting %d messages in bulk and %d one by one", channels, bulk, individually)
+			if failures > 0 {
+				return result, fmt.Errorf("%s, but %d things failed - see the reaper log channels or the bot's logs", result, failures)
+			}
+			return result, nil
+		},
+	},
+	{
+		Name:        "warn",
+		Description: "Warns members who aren't verified as their server needs that they'll be removed",
+		Run: func(bot *Bot, jobConfig JobConfig) (string, error) {
+			if err := loadWarningText(); err != nil {
+				return "", err
+			}
+
+			deadline := jobConfig.Deadline
+			if deadline == "" {
+				deadline = "a few days"
+			}
+
+			warned := 0
+			for guildID, guildConfig := range currentConfig().Guilds {
+				// For now, we ignore alumni guilds in here
+				if guildConfig.AlumniGuild {
+					continue
+				}
+
+				guildWarned, err := bot.warnInvalidUsers(guildID, deadline, false)
+				warned += guildWarned
+				if err != nil {
+					return fmt.Sprintf("warned %d members", warned), err
+				}
+			}
+			return fmt.Sprintf("warned %d members", warned), nil
+		},
+	},
+	{
+		Name:        "expiries",
+		Description: "Removes timed roles once they're due",
+		Default:     &JobConfig{Every: Duration(roleExpiryCheckInterval)},
+		Run: func(bot *Bot, jobConfig JobConfig) (string, error) {
+			expired := bot.ExpireDueRoles()
+			return fmt.Sprintf("removed %d roles", expired), nil
+		},
+		Wake:    roleExpiriesChanged,
+		NextDue: nextRoleExpiry,
+	},
+}
+
+// jobHistory holds the recent runs of every job, oldest first, and which jobs are running.
+// Both are guarded by jobsMutex.
+var jobHistory []JobRun
+var runningJobs = map[string]bool{}
+var jobsMutex sync.Mutex
+
+// errJobRunning is returned when asked to run a job that's already running.
+var errJobRunning = errors.New("the job is already running")
+
+// loadJobHistory reads the history of job runs in from the data directory.
+func loadJobHistory() error {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	return loadJSON(jobHistoryFile, &jobHistory)
+}
+
+// findJob finds the job with the given name, or returns nil if there isn't one.
+func findJob(name string) *Job {
+	for i := range jobs {
+		if jobs[i].Name == name {
+			return &jobs[i]
+		}
+	}
+	return nil
+}
+
+// jobConfig returns when a job should run, and whether it should run at all.
+func jobConfig(job *Job) (JobConfig, bool) {
+	if jobConfig, ok := currentConfig().Jobs[job.Name]; ok {
+		return jobConfig, true
+	}
+	if job.Default != nil {
+		return *job.Default, true
+	}
+	return JobConfig{}, false
+}
+
+// nextJobRun works out when a job configured with jobConfig should next run after the
+// time given, without jitter.
+func nextJobRun(jobConfig JobConfig, after time.Time) (time.Time, error) {
+	if jobConfig.Cron != "" {
+		schedule, err := parseCron(jobConfig.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		next := schedule.Next(after)
+		if next.IsZero() {
+			return time.Time{}, fmt.Errorf("%q never runs", jobConfig.Cron)
+		}
+		return next, nil
+	}
+
+	if jobConfig.Every <= 0 {
+		return time.Time{}, errors.New("jobs need either an every or a cron")
+	}
+	return after.Add(time.Duration(jobConfig.Every)), nil
+}
+
+// validateJobConfig checks that a job's config makes sense.
+func validateJobConfig(name string, jobConfig JobConfig) error {
+	if findJob(name) == nil {
+		return fmt.Errorf("there's no job called %q", name)
+	}
+	if jobConfig.Every != 0 && jobConfig.Cron != "" {
+		return errors.New("jobs can have an every or a cron, but not both")
+	}
+	if jobConfig.Jitter < 0 {
+		return errors.New("jitter can't be negative")
+	}
+	_, err := nextJobRun(jobConfig, time.Now())
+	return err
+}
+
+// RunScheduler runs every job on its schedule. It never returns, so should be run in
+// its own goroutine.
+func (bot *Bot) RunScheduler() {
+	for i := range jobs {
+		go bot.scheduleJob(&jobs[i])
+	}
+	select {}
+}
+
+// scheduleJob runs a job each time it's due. Jobs that aren't configured to run are
+// checked on again every so often, in case the config is reloaded with them in it.
+func (bot *Bot) scheduleJob(job *Job) {
+	var scheduledFor JobConfig
+	var next time.Time
+
+	for {
+		jobConfig, enabled := jobConfig(job)
+		if !enabled {
+			next = time.Time{}
+		} else if next.IsZero() || jobConfig != scheduledFor {
+			// work out the next run afresh when the config changes
+			var err error
+			next, err = nextJobRun(jobConfig, time.Now())
+			if err != nil {
+				log.Println("Not scheduling job", job.Name, "as its config is invalid:", err)
+				next = time.Time{}
+			} else if jobConfig.Jitter > 0 {
+				next = next.Add(time.Duration(rand.Int63n(int64(jobConfig.Jitter))))
+			}
+			scheduledFor = jobConfig
+		}
+
+		wait := schedulerRecheckInterval
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = time.Until(next)
+		}
+		if job.NextDue != nil {
+			if due, ok := job.NextDue(); ok && time.Until(due) < wait {
+				wait = time.Until(due)
+			}
+		}
+		if wait < schedulerMinimumWait {
+			wait = schedulerMinimumWait
+		}
+
+		woken := false
+		select {
+		case <-time.After(wait):
+		case <-job.Wake:
+			woken = true
+		}
+
+		due := !next.IsZero() && !time.Now().Before(next)
+		if job.NextDue != nil {
+			if dueAt, ok := job.NextDue(); ok && !time.Now().Before(dueAt) {
+				due = true
+			}
+		}
+		if !enabled || !(due || woken) {
+			continue
+		}
+
+		if _, err := bot.RunJob(job, jobConfig, false); err != nil && err != errJobRunning {
+			log.Println("Scheduled job", job.Name, "failed with error", err)
+		}
+		next = time.Time{}
+	}
+}
+
+// RunJob runs a job now, unless it's already running, and records the run in the history.
+func (bot *Bot) RunJob(job *Job, jobConfig JobConfig, manual bool) (JobRun, error) {
+	jobsMutex.Lock()
+	if runningJobs[job.Name] {
+		jobsMutex.Unlock()
+		log.Println("Not running job", job.Name, "as it's still running from before")
+		return JobRun{}, errJobRunning
+	}
+	runningJobs[job.Name] = true
+	jobsMutex.Unlock()
+
+	run := JobRun{Job: job.Name, StartedAt: time.Now(), Manual: manual}
+	summary, err := job.Run(bot, jobConfig)
+	run.Duration = time.Since(run.StartedAt)
+	run.Summary = summary
+	if err != nil {
+		run.Error = err.Error()
+	}
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+
+	delete(runningJobs, job.Name)
+	jobHistory = append(jobHistory, run)
+	jobHistory = trimJobHistory(jobHistory)
+	if saveErr := saveJSON(jobHistoryFile, jobHistory); saveErr != nil {
+		log.Println("Failed saving job history with error", saveErr)
+	}
+
+	return run, err
+}
+
+// trimJobHistory drops the oldest runs of each job beyond the most recent maxJobHistory.
+func trimJobHistory(history []JobRun) []JobRun {
+	kept := map[string]int{}
+	trimmed := []JobRun{}
+	for i := len(history) - 1; i >= 0; i-- {
+		if kept[history[i].Job] < maxJobHistory {
+			kept[history[i].Job]++
+			trimmed = append([]JobRun{history[i]}, trimmed...)
+		}
+	}
+	return trimmed
+}
+
+// formatJobRun formats a job run for a message.
+func formatJobRun(run JobRun) string {
+	result := run.Summary
+	if run.Error != "" {
+		result = "❌ " + run.Error
+	}
+	if run.Manual {
+		result += " (run by hand)"
+	}
+	return fmt.Sprintf("<t:%d:R>, took %s - %s", run.StartedAt.Unix(), run.Duration.Round(time.Millisecond), result)
+}
+
+// isBotOwner checks whether a user owns the bot's application, or is on the team that
+// does. Jobs act on every guild at once, so holding a capability in one guild isn't
+// enough to see or run them.
+func (bot *Bot) isBotOwner(userID discord.UserID) (bool, error) {
+	app, err := bot.State.CurrentApplication()
+	if err != nil {
+		return false, err
+	}
+
+	if app.Owner != nil && app.Owner.ID == userID {
+		return true, nil
+	}
+	if app.Team != nil {
+		for _, member := range app.Team.Members {
+			if member.User.ID == userID {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// respondIfNotBotOwner tells the member running a /jobs command that they can't, if they
+// don't own the bot. It returns whether they were told.
+func (bot *Bot) respondIfNotBotOwner(e *gateway.InteractionCreateEvent) (bool, error) {
+	owner, err := bot.isBotOwner(e.Member.User.ID)
+	if err != nil {
+		return false, err
+	}
+	if owner {
+		return false, nil
+	}
+	return true, bot.respondEphemerally(e, "Jobs run across every server the bot is in, so only the bot's owner can see and run them.")
+}
+
+// OnJobsListCommand is run by the interaction event dispatcher when the command to list
+// the scheduled jobs is activated. It shows when each job runs, and its latest runs.
+func (bot *Bot) OnJobsListCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	if refused, err := bot.respondIfNotBotOwner(e); refused || err != nil {
+		return err
+	}
+
+	jobsMutex.Lock()
+	history := append([]JobRun(nil), jobHistory...)
+	running := map[string]bool{}
+	for name := range runningJobs {
+		running[name] = true
+	}
+	jobsMutex.Unlock()
+
+	lines := []string{}
+	for i := range jobs {
+		job := &jobs[i]
+
+		schedule := "not scheduled"
+		if jobConfig, enabled := jobConfig(job); enabled {
+			if jobConfig.Cron != "" {
+				schedule = fmt.Sprintf("on `%s`", jobConfig.Cron)
+			} else {
+				schedule = "every " + formatDuration(time.Duration(jobConfig.Every))
+			}
+			if jobConfig.Jitter > 0 {
+				schedule += ", up to " + formatDuration(time.Duration(jobConfig.Jitter)) + " late"
+			}
+		}
+		if running[job.Name] {
+			schedule += " - running now"
+		}
+		lines = append(lines, fmt.Sprintf("**%s** (%s): %s", job.Name, schedule, job.Description))
+
+		shown := 0
+		for j := len(history) - 1; j >= 0 && shown < 3; j-- {
+			if history[j].Job == job.Name {
+				lines = append(lines, "• "+formatJobRun(history[j]))
+				shown++
+			}
+		}
+	}
+
+	return bot.respondEphemerally(e, truncateMessage(strings.Join(lines, "\n")))
+}
+
+// OnJobsRunCommand is run by the interaction event dispatcher when the command to run a
+// scheduled job straight away is activated.
+func (bot *Bot) OnJobsRunCommand(e *gateway.InteractionCreateEvent, data *discord.CommandInteraction) error {
+	if refused, err := bot.respondIfNotBotOwner(e); refused || err != nil {
+		return err
+	}
+
+	job := findJob(data.Options.Find("job").String())
+	if job == nil {
+		return bot.respondEphemerally(e, "There's no job with that name.")
+	}
+
+	jobConfig, _ := jobConfig(job)
+
+	jobsMutex.Lock()
+	running := runningJobs[job.Name]
+	jobsMutex.Unlock()
+	if running {
+		return bot.respondEphemerally(e, fmt.Sprintf("The %s job is already running - check on it with /jobs list.", job.Name))
+	}
+
+	// jobs can take a lot longer than an interaction can wait, so they carry on in the background
+	go func() {
+		run, err := bot.RunJob(job, jobConfig, true)
+		if err != nil && err != errJobRunning {
+			log.Println("Job", job.Name, "run by", e.Member.User.Tag(), "failed with error", err)
+			return
+		}
+		log.Println("Job", job.Name, "run by", e.Member.User.Tag(), "finished:", run.Summary)
+	}()
+
+	return bot.respondEphemerally(e, fmt.Sprintf("Started the %s job - check on it with /jobs list.", job.Name))
+}
+
+// jobChoices lists the jobs as choices for a command option.
+func jobChoices() []discord.StringChoice {
+	choices := make([]discord.StringChoice, len(jobs))
+	for i, job := range jobs {
+		choices[i] = discord.StringChoice{Name: job.Name, Value: job.Name}
+	}
+	return choices
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTrimJobHistory(t *testing.T) {
+	// runs makes count runs of a job, numbered from first by their summaries
+	runs := func(job string, first int, count int) []JobRun {
+		runs := []JobRun{}
+		for i := first; i < first+count; i++ {
+			runs = append(runs, JobRun{Job: job, Summary: string(rune('a' + i%26))})
+		}
+		return runs
+	}
+
+	tests := []struct {
+		name    string
+		history []JobRun
+		want    []JobRun
+	}{
+		{"empty", nil, []JobRun{}},
+		{"under the limit", runs("reap", 0, 3), runs("reap", 0, 3)},
+		{"at the limit", runs("reap", 0, maxJobHistory), runs("reap", 0, maxJobHistory)},
+		{"over the limit", runs("reap", 0, maxJobHistory+2), runs("reap", 2, maxJobHistory)},
+		{
+			"each job counted separately",
+			append(append(runs("warn", 0, 2), runs("reap", 0, maxJobHistory+1)...), runs("warn", 2, 1)...),
+			append(append(runs("warn", 0, 2), runs("reap", 1, maxJobHistory)...), runs("warn", 2, 1)...),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := trimJobHistory(test.history); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("trimJobHistory kept %d runs %+v, want %d runs %+v", len(got), got, len(test.want), test.want)
+			}
+		})
+	}
+}
+
+func TestRunJobOverlap(t *testing.T) {
+	withDataDir(t)
+	jobsMutex.Lock()
+	previousHistory := jobHistory
+	jobHistory = nil
+	jobsMutex.Unlock()
+	t.Cleanup(func() {
+		jobsMutex.Lock()
+		jobHistory = previousHistory
+		jobsMutex.Unlock()
+	})
+
+	started, release := make(chan struct{}), make(chan struct{})
+	job := &Job{
+		Name: "test",
+		Run: func(bot *Bot, jobConfig JobConfig) (string, error) {
+			close(started)
+			<-release
+			return "done", nil
+		},
+	}
+
+	bot := &Bot{}
+	finished := make(chan error)
+	go func() {
+		_, err := bot.RunJob(job, JobConfig{}, false)
+		finished <- err
+	}()
+	<-started
+
+	if _, err := bot.RunJob(job, JobConfig{}, true); !errors.Is(err, errJobRunning) {
+		t.Errorf("RunJob while the job's running returned error %v, want %v", err, errJobRunning)
+	}
+
+	close(release)
+	select {
+	case err := <-finished:
+		if err != nil {
+			t.Fatalf("RunJob failed with error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunJob didn't finish")
+	}
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	if runningJobs[job.Name] {
+		t.Error("the job is still marked as running after it finished")
+	}
+	if len(jobHistory) != 1 || jobHistory[0].Job != job.Name || jobHistory[0].Summary != "done" || jobHistory[0].Manual {
+		t.Errorf("job history = %+v, want just the scheduled run", jobHistory)
+	}
+}
@@ -0,0 +1,787 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// SetupStep is a step of the setup wizard.
+type SetupStep string
+
+const (
+	SetupVerifiedRoleStep SetupStep = "verified"
+	SetupGuildTypeStep    SetupStep = "type"
+	SetupReaperStep       SetupStep = "reaper"
+	SetupRolePickerStep   SetupStep = "roles"
+	SetupColourPickerStep SetupStep = "colours"
+	SetupReviewStep       SetupStep = "review"
+)
+
+const (
+	// setupSaveAction and setupCancelAction are the setup wizard's buttons that don't go to a step.
+	setupSaveAction   = "save"
+	setupCancelAction = "cancel"
+	// setupCreateVerifiedRole is the option to create a new verified role, rather than use one that exists.
+	setupCreateVerifiedRole = "create"
+	// setupDefaultReapDuration is how long channels newly picked for reaping keep messages for.
+	setupDefaultReapDuration = 7 * 24 * time.Hour
+	// setupMaxSelectOptions is the most options Discord allows in a select menu.
+	setupMaxSelectOptions = 25
+)
+
+// setupSteps are the steps of the setup wizard, in order.
+var setupSteps = []SetupStep{
+	SetupVerifiedRoleStep,
+	SetupGuildTypeStep,
+	SetupReaperStep,
+	SetupRolePickerStep,
+	SetupColourPickerStep,
+	SetupReviewStep,
+}
+
+// setupRequiredPermissions are the permissions the bot needs across a guild, and why.
+var setupRequiredPermissions = []struct {
+	Permission discord.Permissions
+	Reason     string
+}{
+	{discord.PermissionManageRoles, "Manage Roles, to hand out roles"},
+	{discord.PermissionKickMembers, "Kick Members, to remove members who don't verify"},
+	{discord.PermissionCreateInstantInvite, "Create Invite, to invite removed members back"},
+}
+
+// setupSettingKeys are the keys of the settings the setup wizard changes.
+var setupSettingKeys = []string{"verifiedRole", "alumniGuild", "channels", "roles", "colours"}
+
+// setupReaperPermissions are the permissions the bot needs in each channel it reaps.
+const setupReaperPermissions = discord.PermissionViewChannel | discord.PermissionReadMessageHistory | discord.PermissionManageMessages
+
+// SetupDraft holds a guild's config while it's being changed in the setup wizard.
+type SetupDraft struct {
+	Config             GuildConfig
+	CreateVerifiedRole bool
+}
+
+// setupDraftKey identifies a setup wizard draft - each member setting up a guild has their own.
+type setupDraftKey struct {
+	GuildID discord.GuildID
+	UserID  discord.UserID
+}
+
+// setupDrafts holds the setup wizard drafts in progress, by guild and member, guarded by
+// setupDraftsMutex. Running /setup again starts the member's draft over.
+var setupDrafts = map[setupDraftKey]*SetupDraft{}
+var setupDraftsMutex sync.Mutex
+
+// setupDraftKeyFor returns the key of the draft an interaction with the setup wizard is for.
+func setupDraftKeyFor(e *gateway.InteractionCreateEvent) setupDraftKey {
+	return setupDraftKey{GuildID: e.GuildID, UserID: e.Member.User.ID}
+}
+
+// OnSetupCommand is run by the interaction event dispatcher when the command to set up
+// the guild is activated. It starts the setup wizard from the guild's current config.
+func (bot *Bot) OnSetupCommand(e *gateway.InteractionCreateEvent) error {
+	draft := &SetupDraft{Config: currentConfig().Guilds[e.GuildID].clone()}
+
+	// pick up the verified role found by name, for guilds set up before it could be chosen
+	if !draft.Config.VerifiedRole.IsValid() {
+		if verifiedRole, err := bot.getVerifiedRole(e.GuildID); err == nil {
+			draft.Config.VerifiedRole = *verifiedRole
+		}
+	}
+
+	setupDraftsMutex.Lock()
+	setupDrafts[setupDraftKeyFor(e)] = draft
+	setupDraftsMutex.Unlock()
+
+	content, components, err := bot.setupStepContent(e.GuildID, draft, setupSteps[0])
+	if err != nil {
+		return err
+	}
+
+	return bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.MessageInteractionWithSource,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(content),
+			Components: &components,
+			Flags:      api.EphemeralResponse,
+		},
+	})
+}
+
+// OnSetupSelect is run by the interaction event dispatcher when something's chosen from
+// one of the setup wizard's select menus. It updates the draft, and shows the step again.
+func (bot *Bot) OnSetupSelect(e *gateway.InteractionCreateEvent, id CustomID) error {
+	values := e.Data.(*discord.SelectInteraction).Values
+
+	setupDraftsMutex.Lock()
+	defer setupDraftsMutex.Unlock()
+
+	draft, ok := setupDrafts[setupDraftKeyFor(e)]
+	if !ok {
+		return bot.respondSetupExpired(e)
+	}
+
+	// anything that couldn't be shown in the menu can't have been unchosen, so it's kept
+	step := SetupStep(id.Step)
+	_, _, shown, err := bot.setupStepSelect(e.GuildID, draft, step)
+	if err != nil {
+		return err
+	}
+
+	switch step {
+	case SetupVerifiedRoleStep:
+		draft.CreateVerifiedRole = len(values) > 0 && values[0] == setupCreateVerifiedRole
+		draft.Config.VerifiedRole = 0
+		if len(values) > 0 && !draft.CreateVerifiedRole {
+			roleSnowflake, err := discord.ParseSnowflake(values[0])
+			if err != nil {
+				return err
+			}
+			draft.Config.VerifiedRole = discord.RoleID(roleSnowflake)
+		}
+	case SetupGuildTypeStep:
+		draft.Config.AlumniGuild = len(values) > 0 && values[0] == "alumni"
+	case SetupReaperStep:
+		channels := map[discord.ChannelID]ChannelConfig{}
+		for channelID, channelConfig := range draft.Config.Channels {
+			if !shown[channelID.String()] {
+				channels[channelID] = channelConfig
+			}
+		}
+		for _, value := range values {
+			channelSnowflake, err := discord.ParseSnowflake(value)
+			if err != nil {
+				return err
+			}
+
+			channelID := discord.ChannelID(channelSnowflake)
+			channelConfig, existing := draft.Config.Channels[channelID]
+			if !existing {
+				channelConfig = ChannelConfig{ReapDuration: Duration(setupDefaultReapDuration)}
+			}
+			channels[channelID] = channelConfig
+		}
+		draft.Config.Channels = channels
+	case SetupRolePickerStep, SetupColourPickerStep:
+		chosen, err := bot.roleNamesFromIDs(e.GuildID, values)
+		if err != nil {
+			return err
+		}
+		shownIDs := []string{}
+		for value := range shown {
+			shownIDs = append(shownIDs, value)
+		}
+		shownNames, err := bot.roleNamesFromIDs(e.GuildID, shownIDs)
+		if err != nil {
+			return err
+		}
+
+		if step == SetupColourPickerStep {
+			draft.Config.Colours = keepUnshownNames(draft.Config.Colours, shownNames, chosen)
+		} else {
+			names := keepUnshownNames(RoleNames(draft.Config.Roles), shownNames, chosen)
+			draft.Config.Roles = keepRoleConfigs(draft.Config.Roles, names)
+		}
+	default:
+		return fmt.Errorf("unknown setup step %q", step)
+	}
+
+	return bot.updateSetupMessage(e, draft, step)
+}
+
+// OnSetupButton is run by the interaction event dispatcher when one of the setup wizard's
+// buttons is pressed - to move between steps, save the draft, or cancel.
+func (bot *Bot) OnSetupButton(e *gateway.InteractionCreateEvent, id CustomID) error {
+	key := setupDraftKeyFor(e)
+
+	setupDraftsMutex.Lock()
+	draft, ok := setupDrafts[key]
+	if !ok {
+		setupDraftsMutex.Unlock()
+		return bot.respondSetupExpired(e)
+	}
+
+	switch id.Step {
+	case setupCancelAction:
+		delete(setupDrafts, key)
+		setupDraftsMutex.Unlock()
+		return bot.finishSetupMessage(e, "Setup cancelled - nothing's been changed.")
+	case setupSaveAction:
+		// a copy's saved, so that creating the verified role doesn't hold up anyone else's setup
+		saving := &SetupDraft{Config: draft.Config.clone(), CreateVerifiedRole: draft.CreateVerifiedRole}
+		setupDraftsMutex.Unlock()
+
+		err := bot.saveSetupDraft(e, saving)
+
+		setupDraftsMutex.Lock()
+		// a verified role that's been created is kept in the draft, so it isn't created again if saving's retried
+		if draft.CreateVerifiedRole && !saving.CreateVerifiedRole {
+			draft.Config.VerifiedRole = saving.Config.VerifiedRole
+			draft.CreateVerifiedRole = false
+		}
+		if err == nil && setupDrafts[key] == draft {
+			delete(setupDrafts, key)
+		}
+		setupDraftsMutex.Unlock()
+
+		if errors.Is(err, errInconsistentSettings) || errors.Is(err, errInvalidSetting) {
+			return bot.respondEphemerally(e, truncateMessage(fmt.Sprintf("Couldn't save the setup - %v", err)))
+		} else if err != nil {
+			return err
+		}
+
+		refreshed, err := bot.RefreshPickers(e.GuildID)
+		if err != nil {
+			log.Println("Failed refreshing some pickers after setup in guild", e.GuildID, "with error", err)
+		}
+
+		return bot.finishSetupMessage(e, fmt.Sprintf("All set up and saved ✨ Refreshed %d pickers to match.", refreshed))
+	default:
+		defer setupDraftsMutex.Unlock()
+		return bot.updateSetupMessage(e, draft, SetupStep(id.Step))
+	}
+}
+
+// saveSetupDraft checks every setting in the draft, creates the verified role if that's
+// been asked for, then stores the draft as the guild's config. setupDraftsMutex mustn't
+// be held, and the draft mustn't be one that's in setupDrafts.
+func (bot *Bot) saveSetupDraft(e *gateway.InteractionCreateEvent, draft *SetupDraft) error {
+	drafted := Config{Guilds: map[discord.GuildID]GuildConfig{e.GuildID: draft.Config}}
+	values := map[string]string{}
+	for _, key := range setupSettingKeys {
+		setting := findConfigSetting(key)
+		value, err := bot.parseConfigValue(*setting, e.GuildID, setting.Get(drafted, e.GuildID))
+		if err != nil {
+			return fmt.Errorf("%w for %s: %v", errInvalidSetting, setting.Key, err)
+		}
+		values[setting.Key] = value
+	}
+
+	// the role's only created once the rest of the draft is known to be valid
+	if draft.CreateVerifiedRole {
+		role, err := bot.State.CreateRole(e.GuildID, api.CreateRoleData{
+			Name: "verified",
+		})
+		if err != nil {
+			return err
+		}
+
+		draft.Config.VerifiedRole = role.ID
+		draft.CreateVerifiedRole = false
+		values["verifiedRole"] = role.ID.String()
+	}
+
+	if err := setConfigValues(e.GuildID, e.Member.User.ID, values); err != nil {
+		return err
+	}
+
+	forgetVerifiedRole(e.GuildID)
+	log.Println("Guild", e.GuildID, "was set up by", e.Member.User.Tag())
+	return nil
+}
+
+// updateSetupMessage shows a step of the setup wizard in place of the message the
+// interaction came from.
+func (bot *Bot) updateSetupMessage(e *gateway.InteractionCreateEvent, draft *SetupDraft, step SetupStep) error {
+	content, components, err := bot.setupStepContent(e.GuildID, draft, step)
+	if err != nil {
+		return err
+	}
+
+	return bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.UpdateMessage,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(content),
+			Components: &components,
+		},
+	})
+}
+
+// finishSetupMessage replaces the setup wizard's message with a final message.
+func (bot *Bot) finishSetupMessage(e *gateway.InteractionCreateEvent, content string) error {
+	return bot.responder(e).Respond(api.InteractionResponse{
+		Type: api.UpdateMessage,
+		Data: &api.InteractionResponseData{
+			Content:    option.NewNullableString(content),
+			Components: &discord.ContainerComponents{},
+		},
+	})
+}
+
+// respondSetupExpired tells a member that the setup wizard they're using isn't in progress any more.
+func (bot *Bot) respondSetupExpired(e *gateway.InteractionCreateEvent) error {
+	return bot.finishSetupMessage(e, "This setup isn't in progress any more - it was finished, or the bot restarted. Run /setup to start again!")
+}
+
+// setupStepContent builds the text and components for a step of the setup wizard.
+func (bot *Bot) setupStepContent(guildID discord.GuildID, draft *SetupDraft, step SetupStep) (string, discord.ContainerComponents, error) {
+	var content string
+	switch step {
+	case SetupVerifiedRoleStep:
+		content = "**Step 1: verified role**\nWhich role should verified members get?"
+	case SetupGuildTypeStep:
+		content = "**Step 2: server type**\nIs this server for current students, or alumni?"
+	case SetupReaperStep:
+		content = fmt.Sprintf("**Step 3: reaper**\nWhich channels should old messages be deleted from? New channels keep messages for %s - change that with /config.", formatDuration(setupDefaultReapDuration))
+	case SetupRolePickerStep:
+		content = "**Step 4: role picker**\nWhich roles should members be able to pick for themselves?"
+	case SetupColourPickerStep:
+		content = "**Step 5: colour picker**\nWhich roles should the colour picker offer?"
+	case SetupReviewStep:
+		checks, err := bot.checkSetupDraft(guildID, draft)
+		if err != nil {
+			return "", nil, err
+		}
+		content = "**Step 6: review**\n" + formatSetupDraft(draft) + "\n**Checks**\n" + strings.Join(checks, "\n")
+	default:
+		return "", nil, fmt.Errorf("unknown setup step %q", step)
+	}
+
+	selectMenu, hidden, _, err := bot.setupStepSelect(guildID, draft, step)
+	if err != nil {
+		return "", nil, err
+	}
+	if hidden > 0 {
+		content += fmt.Sprintf("\n_%d more that are already chosen don't fit in the menu, so they're kept - change them with /config._", hidden)
+	}
+
+	components := discord.ContainerComponents{}
+	if selectMenu != nil {
+		selectMenu.CustomID = CustomID{Type: SetupSelectID, Step: string(step)}.Encode()
+		components = append(components, &discord.ActionRowComponent{selectMenu})
+	}
+	components = append(components, setupNavigationRow(step))
+
+	return content, components, nil
+}
+
+// setupStepSelect builds the select menu for a step of the setup wizard, if it has one. It
+// also returns how many of the options already chosen didn't fit in the menu, and the
+// values of the options that did.
+func (bot *Bot) setupStepSelect(guildID discord.GuildID, draft *SetupDraft, step SetupStep) (*discord.SelectComponent, int, map[string]bool, error) {
+	var options []discord.SelectOption
+	var err error
+	switch step {
+	case SetupVerifiedRoleStep:
+		var selectMenu *discord.SelectComponent
+		selectMenu, err = bot.setupVerifiedRoleSelect(guildID, draft)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		return selectMenu, 0, nil, nil
+	case SetupGuildTypeStep:
+		return &discord.SelectComponent{
+			Options: []discord.SelectOption{
+				{Label: "Current students", Value: "students", Default: !draft.Config.AlumniGuild},
+				{Label: "Alumni", Value: "alumni", Default: draft.Config.AlumniGuild},
+			},
+		}, 0, nil, nil
+	case SetupReaperStep:
+		options, err = bot.setupReaperOptions(guildID, draft)
+	case SetupRolePickerStep:
+		options, err = bot.setupRoleOptions(guildID, RoleNames(draft.Config.Roles))
+	case SetupColourPickerStep:
+		options, err = bot.setupRoleOptions(guildID, draft.Config.Colours)
+	default:
+		return nil, 0, nil, nil
+	}
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	options, hidden := fitSetupOptions(options)
+	shown := map[string]bool{}
+	for _, option := range options {
+		shown[option.Value] = true
+	}
+
+	placeholder := "Pick channels to reap"
+	switch step {
+	case SetupRolePickerStep:
+		placeholder = "Pick roles to offer"
+	case SetupColourPickerStep:
+		placeholder = "Pick colour roles to offer"
+	}
+	return setupMultiSelect(options, placeholder), hidden, shown, nil
+}
+
+// fitSetupOptions cuts a select menu's options down to the most Discord allows, putting
+// those already chosen first so that they're shown. It returns the options that fit, and
+// how many of those already chosen didn't.
+func fitSetupOptions(options []discord.SelectOption) ([]discord.SelectOption, int) {
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Default && !options[j].Default
+	})
+	if len(options) <= setupMaxSelectOptions {
+		return options, 0
+	}
+
+	hidden := 0
+	for _, option := range options[setupMaxSelectOptions:] {
+		if option.Default {
+			hidden++
+		}
+	}
+	return options[:setupMaxSelectOptions], hidden
+}
+
+// setupNavigationRow builds the buttons to move between the steps of the setup wizard.
+func setupNavigationRow(step SetupStep) *discord.ActionRowComponent {
+	index := 0
+	for i, s := range setupSteps {
+		if s == step {
+			index = i
+		}
+	}
+
+	row := discord.ActionRowComponent{}
+	if index > 0 {
+		row = append(row, &discord.ButtonComponent{
+			CustomID: CustomID{Type: SetupButtonID, Step: string(setupSteps[index-1])}.Encode(),
+			Label:    "Back",
+			Style:    discord.SecondaryButtonStyle(),
+		})
+	}
+
+	if index < len(setupSteps)-1 {
+		row = append(row, &discord.ButtonComponent{
+			CustomID: CustomID{Type: SetupButtonID, Step: string(setupSteps[index+1])}.Encode(),
+			Label:    "Next",
+			Style:    discord.PrimaryButtonStyle(),
+		})
+	} else {
+		row = append(row, &discord.ButtonComponent{
+			CustomID: CustomID{Type: SetupButtonID, Step: setupSaveAction}.Encode(),
+			Label:    "Save",
+			Style:    discord.SuccessButtonStyle(),
+		})
+	}
+
+	row = append(row, &discord.ButtonComponent{
+		CustomID: CustomID{Type: SetupButtonID, Step: setupCancelAction}.Encode(),
+		Label:    "Cancel",
+		Style:    discord.DangerButtonStyle(),
+	})
+
+	return &row
+}
+
+// assignableRoles returns the guild's roles that could be handed out by the bot or
+// picked from a picker, highest first - leaving out @everyone and roles managed by
+// integrations.
+func (bot *Bot) assignableRoles(guildID discord.GuildID) ([]discord.Role, error) {
+	guildRoles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles := []discord.Role{}
+	for _, role := range guildRoles {
+		if discord.Snowflake(role.ID) == discord.Snowflake(guildID) || role.Managed {
+			continue
+		}
+		roles = append(roles, role)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Position > roles[j].Position
+	})
+
+	return roles, nil
+}
+
+// setupVerifiedRoleSelect builds the select menu for choosing the verified role.
+func (bot *Bot) setupVerifiedRoleSelect(guildID discord.GuildID, draft *SetupDraft) (*discord.SelectComponent, error) {
+	roles, err := bot.assignableRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []discord.SelectOption{{
+		Label:   "Create a new role called verified",
+		Value:   setupCreateVerifiedRole,
+		Emoji:   &discord.ComponentEmoji{Name: "✨"},
+		Default: draft.CreateVerifiedRole,
+	}}
+
+	roleOptions := make([]discord.SelectOption, len(roles))
+	for i, role := range roles {
+		roleOptions[i] = discord.SelectOption{
+			Label:   role.Name,
+			Value:   role.ID.String(),
+			Default: role.ID == draft.Config.VerifiedRole,
+		}
+	}
+
+	// the role already chosen goes first, so it's shown however many roles there are
+	roleOptions, _ = fitSetupOptions(roleOptions)
+	options = append(options, roleOptions...)
+	if len(options) > setupMaxSelectOptions {
+		options = options[:setupMaxSelectOptions]
+	}
+
+	return &discord.SelectComponent{Options: options, Placeholder: "Pick the verified role"}, nil
+}
+
+// setupReaperOptions builds the options for choosing the channels to reap, in the order
+// they're shown in Discord.
+func (bot *Bot) setupReaperOptions(guildID discord.GuildID, draft *SetupDraft) ([]discord.SelectOption, error) {
+	channels, err := bot.State.Channels(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(channels, func(i, j int) bool {
+		return channels[i].Position < channels[j].Position
+	})
+
+	options := []discord.SelectOption{}
+	for _, channel := range channels {
+		if channel.Type != discord.GuildText && channel.Type != GuildForum {
+			continue
+		}
+
+		channelConfig, reaped := draft.Config.Channels[channel.ID]
+		option := discord.SelectOption{
+			Label:   "#" + channel.Name,
+			Value:   channel.ID.String(),
+			Default: reaped,
+		}
+		if reaped {
+			option.Description = "Keeps messages for " + formatDuration(time.Duration(channelConfig.ReapDuration))
+		}
+		options = append(options, option)
+	}
+
+	return options, nil
+}
+
+// setupRoleOptions builds the options for choosing roles for a picker, with the roles
+// named in selected already chosen. The bot can only hand out roles below its own, and
+// the roles it creates go at the bottom, so the lowest roles come first.
+func (bot *Bot) setupRoleOptions(guildID discord.GuildID, selected []string) ([]discord.SelectOption, error) {
+	roles, err := bot.assignableRoles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []discord.SelectOption{}
+	for i := len(roles) - 1; i >= 0; i-- {
+		role := roles[i]
+		isSelected := false
+		for _, name := range selected {
+			isSelected = isSelected || strings.EqualFold(name, role.Name)
+		}
+
+		options = append(options, discord.SelectOption{
+			Label:   role.Name,
+			Value:   role.ID.String(),
+			Default: isSelected,
+		})
+	}
+
+	return options, nil
+}
+
+// setupMultiSelect builds a select menu that any number of its options can be chosen from.
+// Select menus need at least one option, so a placeholder option is used if there are none.
+func setupMultiSelect(options []discord.SelectOption, placeholder string) *discord.SelectComponent {
+	if len(options) == 0 {
+		return &discord.SelectComponent{
+			Options:     []discord.SelectOption{{Label: "Nothing to pick from", Value: "none"}},
+			Placeholder: "Nothing to pick from",
+			Disabled:    true,
+		}
+	}
+
+	return &discord.SelectComponent{
+		Options:     options,
+		Placeholder: placeholder,
+		ValueLimits: [2]int{0, len(options)},
+	}
+}
+
+// roleNamesFromIDs looks up the names of the roles with the given IDs.
+func (bot *Bot) roleNamesFromIDs(guildID discord.GuildID, roleIDs []string) ([]string, error) {
+	names := []string{}
+	for _, value := range roleIDs {
+		roleSnowflake, err := discord.ParseSnowflake(value)
+		if err != nil {
+			return nil, err
+		}
+
+		role, err := bot.State.Role(guildID, discord.RoleID(roleSnowflake))
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, role.Name)
+	}
+	return names, nil
+}
+
+// keepUnshownNames works out the names chosen for a picker from a setup select menu. Names
+// that weren't shown in the menu - including those of roles that haven't been created yet -
+// are kept where they were, and names that were shown are kept only if they were chosen
+// again. Newly chosen names go at the end.
+func keepUnshownNames(existing []string, shown []string, chosen []string) []string {
+	isShown := map[string]bool{}
+	for _, name := range shown {
+		isShown[strings.ToLower(name)] = true
+	}
+	isChosen := map[string]bool{}
+	for _, name := range chosen {
+		isChosen[strings.ToLower(name)] = true
+	}
+
+	names := []string{}
+	kept := map[string]bool{}
+	for _, name := range existing {
+		if isChosen[strings.ToLower(name)] || !isShown[strings.ToLower(name)] {
+			names = append(names, name)
+			kept[strings.ToLower(name)] = true
+		}
+	}
+	for _, name := range chosen {
+		if !kept[strings.ToLower(name)] {
+			names = append(names, name)
+			kept[strings.ToLower(name)] = true
+		}
+	}
+	return names
+}
+
+// keepRoleConfigs returns configs for the roles named, keeping the existing config of
+// any that were already configured, so their prerequisites aren't lost.
+func keepRoleConfigs(existing []RoleConfig, names []string) []RoleConfig {
+	roles := []RoleConfig{}
+	for _, name := range names {
+		roleConfig := RoleConfig{Name: name}
+		for _, existingRole := range existing {
+			if strings.EqualFold(existingRole.Name, name) {
+				roleConfig = existingRole
+			}
+		}
+		roles = append(roles, roleConfig)
+	}
+	return roles
+}
+
+// checkSetupDraft checks that the bot will be able to do everything the draft config
+// asks of it - that it has the permissions it needs, and that its role is high enough
+// to hand out the roles involved. It returns a line for each check.
+func (bot *Bot) checkSetupDraft(guildID discord.GuildID, draft *SetupDraft) ([]string, error) {
+	me, err := bot.State.Me()
+	if err != nil {
+		return nil, err
+	}
+
+	botMember, err := bot.State.Member(guildID, me.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := bot.memberGuildPermissions(guildID, *botMember)
+	if err != nil {
+		return nil, err
+	}
+
+	checks := []string{}
+	for _, required := range setupRequiredPermissions {
+		if permissions.Has(required.Permission) || permissions.Has(discord.PermissionAdministrator) {
+			checks = append(checks, "✅ "+required.Reason)
+		} else {
+			checks = append(checks, "⚠️ Missing "+required.Reason)
+		}
+	}
+
+	for channelID := range draft.Config.Channels {
+		channelPermissions, err := bot.State.Permissions(channelID, me.ID)
+		if err != nil || !channelPermissions.Has(setupReaperPermissions) {
+			checks = append(checks, fmt.Sprintf("⚠️ Can't see, read the history of, or delete messages in %s", channelID.Mention()))
+		}
+	}
+
+	guildRoles, err := bot.State.Roles(guildID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the bot can only hand out roles below its own highest role
+	highestPosition := 0
+	for _, role := range guildRoles {
+		if memberHasRole(botMember, role.ID) && role.Position > highestPosition {
+			highestPosition = role.Position
+		}
+	}
+
+	names := append(RoleNames(draft.Config.Roles), draft.Config.Colours...)
+	tooHigh := []string{}
+	for _, role := range guildRoles {
+		handedOut := role.ID == draft.Config.VerifiedRole
+		for _, name := range names {
+			handedOut = handedOut || strings.EqualFold(name, role.Name)
+		}
+
+		if handedOut && role.Position >= highestPosition {
+			tooHigh = append(tooHigh, role.Name)
+		}
+	}
+
+	if len(tooHigh) == 0 {
+		checks = append(checks, "✅ The bot's role is above every role it hands out")
+	} else {
+		checks = append(checks, fmt.Sprintf("⚠️ Move the bot's role above %s in Server Settings, or it can't hand them out", strings.Join(tooHigh, ", ")))
+	}
+
+	return checks, nil
+}
+
+// formatSetupDraft summarises a setup draft for review.
+func formatSetupDraft(draft *SetupDraft) string {
+	var b strings.Builder
+
+	switch {
+	case draft.CreateVerifiedRole:
+		b.WriteString("Verified role: a new role called verified\n")
+	case draft.Config.VerifiedRole.IsValid():
+		fmt.Fprintf(&b, "Verified role: %s\n", draft.Config.VerifiedRole.Mention())
+	default:
+		b.WriteString("Verified role: the role called verified\n")
+	}
+
+	if draft.Config.AlumniGuild {
+		b.WriteString("Server type: alumni\n")
+	} else {
+		b.WriteString("Server type: current students\n")
+	}
+
+	reaped := []string{}
+	for channelID, channelConfig := range draft.Config.Channels {
+		reaped = append(reaped, fmt.Sprintf("%s (%s)", channelID.Mention(), formatDuration(time.Duration(channelConfig.ReapDuration))))
+	}
+	sort.Strings(reaped)
+
+	fmt.Fprintf(&b, "Reaped channels: %s\n", setupListOrNone(reaped))
+	fmt.Fprintf(&b, "Role picker: %s\n", setupListOrNone(RoleNames(draft.Config.Roles)))
+	fmt.Fprintf(&b, "Colour picker: %s\n", setupListOrNone(draft.Config.Colours))
+
+	return b.String()
+}
+
+// setupListOrNone joins a list for display, or says none if it's empty.
+func setupListOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/diamondburned/arikawa/v3/discord"
+)
+
+func TestKeepUnshownNames(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []string
+		shown    []string
+		chosen   []string
+		want     []string
+	}{
+		{"nothing", nil, nil, nil, []string{}},
+		{"newly chosen", nil, []string{"red", "blue"}, []string{"blue"}, []string{"blue"}},
+		{"unchosen", []string{"red", "blue"}, []string{"red", "blue"}, []string{"red"}, []string{"red"}},
+		{"unshown kept", []string{"red", "not created yet"}, []string{"red", "blue"}, []string{"blue"}, []string{"not created yet", "blue"}},
+		{"order kept", []string{"green", "red", "blue"}, []string{"red", "blue", "green"}, []string{"blue", "green", "red"}, []string{"green", "red", "blue"}},
+		{"names match whatever their case", []string{"Red"}, []string{"red"}, []string{"RED"}, []string{"Red"}},
+		{"chosen twice", nil, []string{"red"}, []string{"red", "Red"}, []string{"red"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := keepUnshownNames(test.existing, test.shown, test.chosen)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("keepUnshownNames(%q, %q, %q) = %q, want %q", test.existing, test.shown, test.chosen, got, test.want)
+			}
+		})
+	}
+}
+
+func TestFitSetupOptions(t *testing.T) {
+	// options makes count options, with those at the indexes given already chosen
+	options := func(count int, chosen ...int) []discord.SelectOption {
+		options := make([]discord.SelectOption, count)
+		for i := range options {
+			options[i] = discord.SelectOption{Value: string(rune('A' + i))}
+		}
+		for _, i := range chosen {
+			options[i].Default = true
+		}
+		return options
+	}
+
+	tests := []struct {
+		name       string
+		options    []discord.SelectOption
+		wantFirst  string
+		wantLength int
+		wantHidden int
+	}{
+		{"none", options(0), "", 0, 0},
+		{"fits", options(3, 2), "C", 3, 0},
+		{"exactly fits", options(setupMaxSelectOptions, 24), "Y", setupMaxSelectOptions, 0},
+		{"chosen moved into the menu", options(30, 29), "^", setupMaxSelectOptions, 0},
+		{"too many chosen", options(30, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26), "A", setupMaxSelectOptions, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, hidden := fitSetupOptions(test.options)
+			if len(got) != test.wantLength || hidden != test.wantHidden {
+				t.Fatalf("fitSetupOptions returned %d options with %d hidden, want %d with %d hidden", len(got), hidden, test.wantLength, test.wantHidden)
+			}
+			if len(got) > 0 && got[0].Value != test.wantFirst {
+				t.Errorf("fitSetupOptions put %q first, want %q", got[0].Value, test.wantFirst)
+			}
+
+			// the options already chosen come first, in their order
+			seenUnchosen := false
+			for _, option := range got {
+				if option.Default && seenUnchosen {
+					t.Errorf("fitSetupOptions put chosen option %q after an unchosen one", option.Value)
+				}
+				seenUnchosen = seenUnchosen || !option.Default
+			}
+		})
+	}
+}
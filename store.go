@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// dataPath returns the path of a file in the bot's data directory, which holds
+// state that must survive restarts. It's set with $DATA_DIR, defaulting to "data".
+func dataPath(name string) string {
+	dir := os.Getenv("DATA_DIR")
+	if dir == "" {
+		dir = "data"
+	}
+	return filepath.Join(dir, name)
+}
+
+// loadJSON reads a JSON file from the data directory into v. A missing file
+// isn't an error - it just means nothing has been saved yet, so v is left as-is.
+func loadJSON(name string, v interface{}) error {
+	contents, err := ioutil.ReadFile(dataPath(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+// saveJSON writes v as JSON to a file in the data directory. It writes to a
+// temporary file first and renames it over the old one, so a crash halfway
+// through never leaves a truncated file behind.
+func saveJSON(name string, v interface{}) error {
+	path := dataPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	contents, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(path+".tmp", contents, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+)
+
+// GuildForum is the type of forum channels, whose posts are each a thread. arikawa
+// v3.0.0 predates them, so doesn't have a constant for it.
+const GuildForum discord.ChannelType = 15
+
+// Things the reaper can do with threads that have had no activity for longer than their
+// channel's reap duration.
+const (
+	staleThreadsLock   = "lock"
+	staleThreadsDelete = "delete"
+)
+
+// archivedThreadsPageSize is how many archived threads are fetched at once - the most
+// Discord allows.
+const archivedThreadsPageSize = 100
+
+// archivedThreadsPage is a page of a channel's archived threads. arikawa v3.0.0 expects a
+// list of these rather than the single one Discord sends, so they're fetched directly.
+type archivedThreadsPage struct {
+	Threads []discord.Channel `json:"threads"`
+	HasMore bool              `json:"has_more"`
+}
+
+// channelThreads returns the threads in a channel, or the posts in a forum - both those
+// that are active and those that have been archived. Private archived threads are only
+// included if the bot is allowed to see them.
+func (b *Bot) channelThreads(guildID discord.GuildID, channel discord.Channel) ([]discord.Channel, error) {
+	channelID := channel.ID
+	active, err := b.State.ActiveThreads(guildID)
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching active threads: %w", err)
+	}
+
+	threads := []discord.Channel{}
+	for _, thread := range active.Threads {
+		if thread.ParentID == channelID {
+			threads = append(threads, thread)
+		}
+	}
+
+	public, err := b.archivedThreads(channelID, "public")
+	if err != nil {
+		return nil, fmt.Errorf("failed fetching archived threads: %w", err)
+	}
+	threads = append(threads, public...)
+
+	// only text channels have private threads
+	if channel.Type != discord.GuildText {
+		return threads, nil
+	}
+	private, err := b.archivedThreads(channelID, "private")
+	if isForbidden(err) {
+		log.Println("Not allowed to see private archived threads in channel", channelID, "- skipping them")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed fetching private archived threads: %w", err)
+	}
+	return append(threads, private...), nil
+}
+
+// archivedThreads fetches all of a channel's public or private archived threads, a page
+// at a time.
+func (b *Bot) archivedThreads(channelID discord.ChannelID, visibility string) ([]discord.Channel, error) {
+	threads := []discord.Channel{}
+	before := ""
+	for {
+		query := url.Values{"limit": {strconv.Itoa(archivedThreadsPageSize)}}
+		if before != "" {
+			query.Set("before", before)
+		}
+
+		var page archivedThreadsPage
+		err := b.State.RequestJSON(&page, "GET", api.EndpointChannels+channelID.String()+"/threads/archived/"+visibility+"?"+query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		threads = append(threads, page.Threads...)
+
+		// pages come most recently archived first
+		if !page.HasMore || len(page.Threads) == 0 {
+			return threads, nil
+		}
+		last := page.Threads[len(page.Threads)-1]
+		if last.ThreadMetadata == nil {
+			return threads, nil
+		}
+		before = last.ThreadMetadata.ArchiveTimestamp.Format(discord.TimestampFormat)
+	}
+}
+
+// threadLastActivity returns when a thread last had a message sent in it, or when it was
+// created if it's never had one.
+func threadLastActivity(thread discord.Channel) time.Time {
+	if thread.LastMessageID.IsValid() {
+		return thread.LastMessageID.Time()
+	}
+	return thread.ID.Time()
+}
+
+// isThread checks whether a channel is a thread, including forum posts.
+func isThread(channel discord.Channel) bool {
+	switch channel.Type {
+	case discord.GuildNewsThread, discord.GuildPublicThread, discord.GuildPrivateThread:
+		return true
+	default:
+		return false
+	}
+}
+
+// threadArchived checks whether a thread has been archived.
+func threadArchived(thread discord.Channel) bool {
+	return thread.ThreadMetadata != nil && thread.ThreadMetadata.Archived
+}
+
+// reapThreads reaps the messages in each of a channel's threads, then locks or deletes
+// those that have gone stale if the channel's configured to. Anything that fails is noted
+// in the summary.
+func (b *Bot) reapThreads(guildID discord.GuildID, channel discord.Channel, channelConfig ChannelConfig, summary *ReapSummary) {
+	threads, err := b.channelThreads(guildID, channel)
+	if err != nil {
+		summary.fail(channel.ID, 0, err)
+		return
+	}
+
+	limit := time.Now().Add(-time.Duration(channelConfig.ReapDuration))
+	for _, thread := range threads {
+		// a thread that couldn't be reaped might not have been archived either, so it's left alone
+		left, reaped := b.reapChannelOrThread(guildID, thread, channelConfig, summary)
+		if !reaped {
+			continue
+		}
+
+		if channelConfig.StaleThreads == "" || threadLastActivity(thread).After(limit) {
+			continue
+		}
+		action := staleThreadAction(channelConfig.StaleThreads, left)
+		if action != channelConfig.StaleThreads {
+			log.Println("Stale thread", thread.ID, "still has", left, "messages that weren't reaped, so locking it rather than deleting it")
+		}
+		if err := b.handleStaleThread(thread, action, summary); err != nil {
+			summary.fail(thread.ID, 0, fmt.Errorf("failed to %s stale thread: %w", action, err))
+		}
+	}
+}
+
+// staleThreadAction works out what to do with a stale thread, given what its channel is
+// configured to do and how many of its messages were left when it was reaped.
+func staleThreadAction(configured string, left int) string {
+	// deleting a thread deletes everything in it, including messages that were kept or couldn't be archived
+	if configured == staleThreadsDelete && left > 0 {
+		return staleThreadsLock
+	}
+	return configured
+}
+
+// handleStaleThread locks or deletes a thread that's had no activity for too long.
+func (b *Bot) handleStaleThread(thread discord.Channel, action string, summary *ReapSummary) error {
+	reason := api.AuditLogReason(fmt.Sprintf("Thread has had no activity since %s", threadLastActivity(thread).Format(time.RFC822)))
+
+	if summary.Preview != nil {
+		summary.Preview.StaleThreads[action] = append(summary.Preview.StaleThreads[action], thread.ID)
+		return nil
+	}
+
+	switch action {
+	case staleThreadsDelete:
+		log.Println("Deleting stale thread", thread.ID, "from channel", thread.ParentID)
+		err := withRateLimitRetries(func() error { return b.State.DeleteChannel(thread.ID, reason) })
+		if err == nil {
+			summary.ThreadsDeleted++
+		}
+		return err
+	case staleThreadsLock:
+		if thread.ThreadMetadata != nil && thread.ThreadMetadata.Locked && thread.ThreadMetadata.Archived {
+			return nil
+		}
+		log.Println("Locking stale thread", thread.ID, "from channel", thread.ParentID)
+		err := withRateLimitRetries(func() error {
+			return b.State.ModifyChannel(thread.ID, api.ModifyChannelData{
+				Archived:       option.True,
+				Locked:         option.True,
+				AuditLogReason: reason,
+			})
+		})
+		if err == nil {
+			summary.ThreadsLocked++
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown staleThreads action %q", action)
+	}
+}
+
+// setThreadArchived archives or unarchives a thread, keeping whether it's locked.
+func (b *Bot) setThreadArchived(thread discord.Channel, archived bool) error {
+	archivedOption := option.False
+	if archived {
+		archivedOption = option.True
+	}
+	return b.State.ModifyChannel(thread.ID, api.ModifyChannelData{
+		Archived:       archivedOption,
+		AuditLogReason: api.AuditLogReason("Reaping old messages in archived thread"),
+	})
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestStaleThreadAction(t *testing.T) {
+	tests := []struct {
+		configured string
+		left       int
+		want       string
+	}{
+		{staleThreadsLock, 0, staleThreadsLock},
+		{staleThreadsLock, 3, staleThreadsLock},
+		{staleThreadsDelete, 0, staleThreadsDelete},
+		{staleThreadsDelete, 1, staleThreadsLock},
+	}
+
+	for _, test := range tests {
+		if got := staleThreadAction(test.configured, test.left); got != test.want {
+			t.Errorf("staleThreadAction(%q, %d) = %q, want %q", test.configured, test.left, got, test.want)
+		}
+	}
+}
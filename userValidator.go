@@ -17,39 +17,47 @@ type UserWarningInformation struct {
 
 var warningText *template.Template
 
-// init loads in the warning text template.
-func init() {
+// loadWarningText loads in the warning text template.
+func loadWarningText() error {
 	var err error
 	warningText, err = template.New("warningText.got").Funcs(template.FuncMap{
-		"aOrAn": func(nextWord string) string {
-			for _, letter := range []rune{'a', 'e', 'i', 'o', 'u'} {
-				if []rune(nextWord)[0] == letter {
-					return "an " + nextWord
-				}
-			}
-			return "a " + nextWord
-		},
+		"aOrAn": aOrAn,
 	}).ParseFiles("templates/warningText.got")
 	if err != nil {
-		log.Fatalln("Failed to parse template file for warning text with err", err)
+		return fmt.Errorf("failed to parse template file for warning text: %w", err)
+	}
+	return nil
+}
+
+// aOrAn prefixes a word with the right indefinite article.
+func aOrAn(nextWord string) string {
+	for _, letter := range []rune{'a', 'e', 'i', 'o', 'u'} {
+		if []rune(nextWord)[0] == letter {
+			return "an " + nextWord
+		}
 	}
+	return "a " + nextWord
 }
 
 // warnInvalidUsers finds invalid users in a given guild and sends them a warning message,
-// notifying them that they may soon be removed for not having verified.
-func (b *Bot) warnInvalidUsers(guildID discord.GuildID) {
+// notifying them that they may soon be removed for not having verified by the deadline.
+// If dryRun is set, no messages are sent - the users are just logged. It returns how many
+// users were found.
+func (b *Bot) warnInvalidUsers(guildID discord.GuildID, deadline string, dryRun bool) (int, error) {
 	guild, err := b.State.Guild(guildID)
 	if err != nil {
-		log.Fatalln("Failed fetching guild for", guildID, "with error", err)
+		return 0, fmt.Errorf("failed fetching guild %s: %w", guildID, err)
 	}
 
 	memberTypeForGuild := getMemberTypeForGuild(guildID)
 
-	b.findInvalidMembersInGuild(guildID, memberTypeForGuild, func(user discord.User, actualUserType string) {
+	warned := 0
+	err = b.findInvalidMembersInGuild(guildID, memberTypeForGuild, func(user discord.User, actualUserType string) {
 		log.Println("User", user.Username, "is not correctly authenticated - messaging")
-		if !warnInvalidDryRunMode {
+		warned++
+		if !dryRun {
 			var messageToSend bytes.Buffer
-			warningText.Execute(&messageToSend, UserWarningInformation{guild.Name, warnInvalidDeadline, GetStudentTypeFromCode(actualUserType), memberTypeForGuild})
+			warningText.Execute(&messageToSend, UserWarningInformation{guild.Name, deadline, GetStudentTypeFromCode(actualUserType), memberTypeForGuild})
 
 			memberChannel, err := b.State.CreatePrivateChannel(user.ID)
 			if err != nil {
@@ -62,7 +70,7 @@ func (b *Bot) warnInvalidUsers(guildID discord.GuildID) {
 				Components: *discord.ComponentsPtr(
 					&discord.ActionRowComponent{
 						&discord.ButtonComponent{
-							CustomID: discord.ComponentID("verifyme_button_guild_" + guildID.String()),
+							CustomID: CustomID{Type: VerifyInGuildButtonID, GuildID: guildID}.Encode(),
 							Label:    "Let's get verified!",
 							Emoji: &discord.ComponentEmoji{
 								Name: "🎉",
@@ -75,16 +83,17 @@ func (b *Bot) warnInvalidUsers(guildID discord.GuildID) {
 		}
 	})
 
+	return warned, err
 }
 
 // purgeInvalidUsers finds invalid users in a guild and removes them for not having verified.
-func (b *Bot) PurgeInvalidUsers(guildID discord.GuildID) {
+func (b *Bot) PurgeInvalidUsers(guildID discord.GuildID) error {
 	guild, err := b.State.Guild(guildID)
 	if err != nil {
-		log.Fatalln("Failed fetching guild for", guildID, "with error", err)
+		return fmt.Errorf("failed fetching guild %s: %w", guildID, err)
 	}
 
-	b.findInvalidMembersInGuild(guildID, getMemberTypeForGuild(guildID), func(user discord.User, actualUserType string) {
+	return b.findInvalidMembersInGuild(guildID, getMemberTypeForGuild(guildID), func(user discord.User, actualUserType string) {
 		log.Println("User", user.Username, "is not correctly authenticated - purging")
 		b.State.Kick(guildID, user.ID, api.AuditLogReason("Incorrectly authenticated for this server and an invalid member purge is running - was: "+actualUserType))
 
@@ -96,7 +105,8 @@ func (b *Bot) PurgeInvalidUsers(guildID discord.GuildID) {
 
 		message, err := b.createReinviteMessage(guildID, user)
 		if err != nil {
-			log.Fatalln("Failed creating reinvite message for user", user.Username, "with error", err)
+			log.Println("Failed creating reinvite message for user", user.Username, "with error", err)
+			return
 		}
 
 		message.Content = fmt.Sprintf(`You weren't verified for the %s server for this academic year, so we've had to say goodbye for now. Need to reverify? Hit the button below.
@@ -106,10 +116,35 @@ func (b *Bot) PurgeInvalidUsers(guildID discord.GuildID) {
 	})
 }
 
-func (b *Bot) findInvalidMembersInGuild(guildID discord.GuildID, memberTypeForGuild StudentType, runForEachInvalidMember func(discord.User, string)) {
-	memberList, err := b.State.Members(guildID)
+// reportInvalidUsers logs the invalid users in a guild, and how many there are, without
+// messaging them.
+func (b *Bot) reportInvalidUsers(guildID discord.GuildID) error {
+	memberTypeForGuild := getMemberTypeForGuild(guildID)
+
+	invalid := 0
+	err := b.findInvalidMembersInGuild(guildID, memberTypeForGuild, func(user discord.User, actualUserType string) {
+		invalid++
+		if actualUserType == "" {
+			log.Println("User", user.Tag(), "in guild", guildID, "hasn't authenticated")
+		} else {
+			log.Println("User", user.Tag(), "in guild", guildID, "is authenticated as", actualUserType, "rather than", memberTypeForGuild.Name())
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Println("Guild", guildID, "has", invalid, "members who aren't authenticated as", aOrAn(memberTypeForGuild.Name()))
+	return nil
+}
+
+// findInvalidMembersInGuild runs a function for each member of a guild who isn't
+// authenticated as the guild needs, with the type they are authenticated as, if any.
+func (b *Bot) findInvalidMembersInGuild(guildID discord.GuildID, memberTypeForGuild StudentType, runForEachInvalidMember func(discord.User, string)) error {
+	// the state only has some members while serving, so ask Discord for all of them
+	memberList, err := b.State.Session.Members(guildID, 0)
 	if err != nil {
-		log.Fatalln("Failed fetching member list from guild", guildID, "with error", err)
+		return fmt.Errorf("failed fetching member list from guild %s: %w", guildID, err)
 	}
 
 	for _, member := range memberList {
@@ -123,4 +158,5 @@ func (b *Bot) findInvalidMembersInGuild(guildID discord.GuildID, memberTypeForGu
 			runForEachInvalidMember(member.User, userType)
 		}
 	}
+	return nil
 }